@@ -0,0 +1,85 @@
+package diffdb
+
+import (
+	"bytes"
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// ErrInvariantViolation indicates that AuditInvariants found the differential in an inconsistent state.
+var ErrInvariantViolation = errors.New("diffdb: invariant violation")
+
+// AuditInvariants checks the internal consistency of the differential in a single read transaction,
+// returning a multierror with an error wrapping ErrInvariantViolation for each violation found, or nil if there are none.
+// It verifies that:
+//
+//   - every committed hash is either a valid hash or the tombstone of an ID deleted with Remove;
+//   - every pending hash is a valid hash and has a payload;
+//   - no pending hash equals the committed hash of its ID, which Add should have deduplicated, unless WithoutDedup is used;
+//   - every stored payload is referenced by a pending change, unless the differential uses shared content;
+//   - every failed marker refers to a pending change.
+//
+// This is more thorough than Checksum, which only verifies committed hashes, and can be run in tests
+// or periodically in production to detect corruption early. It reads every entry of the differential.
+func (diff *Differential) AuditInvariants() error {
+	size := diff.hashLen
+
+	var violations *multierror.Error
+	violation := func(format string, args ...interface{}) {
+		violations = multierror.Append(violations, errors.Wrapf(ErrInvariantViolation, "diffdb: AuditInvariants: "+format, args...))
+	}
+
+	err := diff.db.View(func(tx *bolt.Tx) error {
+		var (
+			b   = tx.Bucket(diff.q)
+			bh  = b.Bucket(bucketHashes)
+			bph = b.Bucket(bucketPendingHashes)
+			pd  = payloadsOf(b)
+		)
+
+		bh.ForEach(func(id, hash []byte) error {
+			if !isTombstone(hash) && len(hash) != size {
+				violation("committed hash of id %x has length %d, expected %d", id, len(hash), size)
+			}
+			return nil
+		})
+
+		referenced := make(map[string]struct{})
+		bph.ForEach(func(id, hash []byte) error {
+			referenced[string(hash)] = struct{}{}
+			if len(hash) != size {
+				violation("pending hash of id %x has length %d, expected %d", id, len(hash), size)
+			}
+			if pd.Get(hash) == nil {
+				violation("pending change of id %x has no payload", id)
+			}
+			if !diff.noDedup && bytes.Equal(hash, bh.Get(id)) {
+				violation("pending hash of id %x equals its committed hash", id)
+			}
+			return nil
+		})
+
+		if _, shared := pd.(sharedStore); !shared {
+			b.Bucket(bucketPendingHashData).ForEach(func(hash, _ []byte) error {
+				if _, ok := referenced[string(hash)]; !ok {
+					violation("payload %x is not referenced by a pending change", hash)
+				}
+				return nil
+			})
+		}
+
+		b.Bucket(bucketFailed).ForEach(func(id, _ []byte) error {
+			if bph.Get(id) == nil {
+				violation("failed id %x has no pending change", id)
+			}
+			return nil
+		})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return violations.ErrorOrNil()
+}
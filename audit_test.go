@@ -0,0 +1,52 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/go-multierror"
+	"strconv"
+	"testing"
+)
+
+func TestDifferential_AuditInvariants(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_audit")
+	defer done()
+
+	for i := 0; i < 4; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.EachN(context.Background(), func(id []byte, data Decoder) error { return nil }, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Remove([]byte("0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.AuditInvariants(); err != nil {
+		t.Fatalf("Expected no violations; got %v", err)
+	}
+
+	// Corrupt the differential: a pending change without a payload and equal to its committed hash,
+	// and a failed marker without a pending change
+	err := diff.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diff.q)
+		committed := b.Bucket(bucketHashes).Get([]byte("1"))
+		if err := b.Bucket(bucketPendingHashes).Put([]byte("1"), committed); err != nil {
+			return err
+		}
+		return b.Bucket(bucketFailed).Put([]byte("9"), []byte("failed"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = diff.AuditInvariants()
+	if !errors.Is(err, ErrInvariantViolation) {
+		t.Fatalf("Expected %q; got %v", ErrInvariantViolation, err)
+	}
+	if n := len(err.(*multierror.Error).Errors); n != 3 {
+		t.Fatalf("Expected 3 violations; got %d: %v", n, err)
+	}
+}
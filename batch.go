@@ -0,0 +1,76 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/boltdb/bolt"
+)
+
+// AddResult summarises the outcome of adding a batch of objects.
+type AddResult struct {
+	// Created is the number of objects whose ID had no committed version.
+	Created int
+	// Updated is the number of objects that differed from their committed version.
+	Updated int
+	// Unchanged is the number of objects that were identical to their committed or pending version.
+	Unchanged int
+}
+
+// Changed returns the total number of objects that were staged as pending changes.
+func (r AddResult) Changed() int {
+	return r.Created + r.Updated
+}
+
+// AddBatch adds each object in objs to the list of pending changes in a single transaction.
+// If an error occurs or the context is cancelled then none of the objects are added.
+func (diff *Differential) AddBatch(ctx context.Context, objs []Object) (AddResult, error) {
+	return diff.addBatch(ctx, len(objs), func(i int) ([]byte, interface{}) {
+		return objs[i].ID(), objs[i]
+	})
+}
+
+// AddBatchFunc is like AddBatch but accepts items that do not implement Object,
+// using idFn to extract the ID of each item.
+func (diff *Differential) AddBatchFunc(ctx context.Context, items []interface{}, idFn func(interface{}) []byte) (AddResult, error) {
+	return diff.addBatch(ctx, len(items), func(i int) ([]byte, interface{}) {
+		return idFn(items[i]), items[i]
+	})
+}
+
+// addBatch adds n items returned by item in a single transaction.
+func (diff *Differential) addBatch(ctx context.Context, n int, item func(i int) ([]byte, interface{})) (result AddResult, err error) {
+	if err = diff.ops.begin(); err != nil {
+		return
+	}
+	defer diff.ops.end()
+
+	err = diff.update(func(tx *bolt.Tx) error {
+		diff.observeTxStats(tx, "add")
+		result = AddResult{}
+		for i := 0; i < n; i++ {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+
+			id, x := item(i)
+			status, _, err := diff.stage(tx, id, x, nil, nil)
+			if err != nil {
+				return err
+			}
+			switch status {
+			case addCreated:
+				result.Created++
+			case addUpdated:
+				result.Updated++
+			default:
+				result.Unchanged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return AddResult{}, err
+	}
+	return
+}
@@ -0,0 +1,122 @@
+package diffdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestDifferential_AddBatch(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_batch")
+	defer done()
+
+	result, err := diff.AddBatch(context.Background(), []Object{
+		NewIDObject([]byte("a"), 1),
+		NewIDObject([]byte("b"), 2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (AddResult{Created: 2}) {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = diff.AddBatch(context.Background(), []Object{
+		NewIDObject([]byte("a"), 1),
+		NewIDObject([]byte("b"), 3),
+		NewIDObject([]byte("c"), 4),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (AddResult{Created: 1, Updated: 1, Unchanged: 1}) {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if result.Changed() != 2 {
+		t.Fatalf("Expected 2 changed objects; got %d", result.Changed())
+	}
+}
+
+func TestDifferential_AddBatchFunc(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_batch")
+	defer done()
+
+	type row struct {
+		Key   string
+		Value int
+	}
+
+	result, err := diff.AddBatchFunc(context.Background(), []interface{}{
+		row{Key: "a", Value: 1},
+		row{Key: "b", Value: 2},
+	}, func(x interface{}) []byte {
+		return []byte(x.(row).Key)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (AddResult{Created: 2}) {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	var r row
+	found, err := diff.Pending([]byte("b"), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || r.Value != 2 {
+		t.Fatalf("Expected pending row b with value 2; got %+v (found %t)", r, found)
+	}
+}
+
+func TestDifferential_NewStreamAdder(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_stream_adder")
+	defer done()
+
+	s := diff.NewStreamAdder(context.Background(), 3)
+	for i := 0; i < 7; i++ {
+		if err := s.Add(NewIDObject([]byte(strconv.Itoa(i%5)), i%5)); err != nil {
+			t.Fatal(err)
+		}
+		// Objects are committed every 3 objects
+		if pending, expect := diff.CountChanges(), map[int]int{2: 3, 5: 5}[i]; expect > 0 && pending != expect {
+			t.Fatalf("Expected %d pending changes after %d objects; got %d", expect, i+1, pending)
+		}
+	}
+	if pending := diff.CountChanges(); pending != 5 {
+		t.Fatalf("Expected the final batch to be buffered; got %d pending", pending)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if result := s.Result(); result != (AddResult{Created: 5, Unchanged: 2}) {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if err := s.Add(NewIDObject([]byte("x"), 0)); err != ErrClosed {
+		t.Fatalf("Expected %q; got %v", ErrClosed, err)
+	}
+}
+
+func TestDifferential_NewStreamAdder_Cancelled(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_stream_adder_cancelled")
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := diff.NewStreamAdder(ctx, 0)
+	if err := s.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	if err := s.Close(); err != context.Canceled {
+		t.Fatalf("Expected %q; got %v", context.Canceled, err)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected nothing to be committed after cancellation; got %d pending", pending)
+	}
+}
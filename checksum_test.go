@@ -0,0 +1,48 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestDifferential_Checksum(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	a, err := db.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := db.Open("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apply := func(diff *Differential, objs ...Object) []byte {
+		for _, obj := range objs {
+			if _, err := diff.Add(obj); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := diff.Checksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+
+	sumA := apply(a, NewIDObject([]byte("1"), 1), NewIDObject([]byte("2"), 2))
+	sumB := apply(b, NewIDObject([]byte("2"), 2), NewIDObject([]byte("1"), 1))
+	if !bytes.Equal(sumA, sumB) {
+		t.Fatalf("Expected equal checksums; got %x and %x", sumA, sumB)
+	}
+
+	sumB = apply(b, NewIDObject([]byte("2"), 3))
+	if bytes.Equal(sumA, sumB) {
+		t.Fatal("Expected checksums to differ after a change")
+	}
+}
@@ -0,0 +1,158 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// ApplyChunkFunc is a function to be called to apply a chunk of pending changes given to EachChunk.
+// ids and decoders have the same length, with decoders[i] decoding the payload of ids[i].
+// If it returns ErrSkip then every change in the chunk is left pending and is not reported as an error.
+type ApplyChunkFunc func(ids [][]byte, decoders []Decoder) error
+
+// EachChunk is like Each but gives f up to size pending changes at a time in ID order,
+// which maps onto downstream bulk APIs more efficiently than applying each change individually.
+// If f succeeds then every change in the chunk is committed, otherwise none are:
+// the error is reported by EachChunk, every change in the chunk is marked as failed and the next chunk is applied.
+// Changes that fail validation are marked as failed and are not included in a chunk.
+// If the context is cancelled then the chunks applied so far are committed.
+// If size is <= 0 then all pending changes are given to f in a single chunk.
+func (diff *Differential) EachChunk(ctx context.Context, size int, f ApplyChunkFunc) error {
+	if err := diff.ops.begin(); err != nil {
+		return err
+	}
+	defer diff.ops.end()
+
+	var updateErr *multierror.Error
+	err := diff.retry.do(func() (bool, error) {
+		tx, err := diff.db.Begin(true)
+		if err != nil {
+			return true, err
+		}
+		defer tx.Rollback()
+		diff.observeTxStats(tx, "each")
+
+		updateErr, err = diff.eachChunkTx(ctx, tx, size, f)
+		if err != nil {
+			return false, err
+		}
+		return true, errors.Wrap(tx.Commit(), "diffdb: EachChunk: commit")
+	})
+	if err != nil {
+		return err
+	}
+
+	return updateErr.ErrorOrNil()
+}
+
+// A chunkChange is a pending change collected into a chunk by eachChunkTx.
+type chunkChange struct {
+	id, hash, data []byte
+}
+
+// eachChunkTx applies f to chunks of up to size pending changes within tx.
+func (diff *Differential) eachChunkTx(ctx context.Context, tx *bolt.Tx, size int, f ApplyChunkFunc) (*multierror.Error, error) {
+	start := time.Now()
+
+	b := tx.Bucket(diff.q)
+	var (
+		bphd = payloadsOf(b)
+		cur  = b.Bucket(bucketPendingHashes).Cursor()
+	)
+
+	var updateErr *multierror.Error
+	var i int
+	var last, after []byte
+
+	for {
+		select {
+		case <-ctx.Done():
+			updateErr = multierror.Append(updateErr, ctx.Err())
+			return updateErr, diff.finishEach(tx, start, i, last)
+		default:
+		}
+
+		// Changes are committed between chunks, so the cursor is repositioned after the previous chunk
+		id, hash := cur.First()
+		if after != nil {
+			id, hash = cur.Seek(after)
+			if bytes.Equal(id, after) {
+				id, hash = cur.Next()
+			}
+		}
+
+		var chunk []chunkChange
+		for ; id != nil && (size <= 0 || len(chunk) < size); id, hash = cur.Next() {
+			after = append(after[:0], id...)
+
+			data := bphd.Get(hash)
+			if data == nil {
+				return nil, errors.Wrapf(ErrMissingHashData, "diffdb: EachChunk: id %x", id)
+			}
+			change := chunkChange{
+				id:   append([]byte(nil), id...),
+				hash: append([]byte(nil), hash...),
+				data: append([]byte(nil), data...),
+			}
+
+			// Changes that fail validation or are vetoed are never given to f and follow the same path as a failed change
+			if err := diff.vet(change.id, &msgpackDecoder{data: change.data}, tx); err != nil {
+				if errors.Is(err, ErrSkip) {
+					continue
+				}
+				updateErr = multierror.Append(updateErr, err)
+				if err := diff.markFailed(b, change.id, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			chunk = append(chunk, change)
+		}
+		if len(chunk) == 0 {
+			break
+		}
+
+		var (
+			ids      = make([][]byte, len(chunk))
+			decoders = make([]Decoder, len(chunk))
+		)
+		for j, change := range chunk {
+			ids[j] = change.id
+			decoders[j] = &msgpackDecoder{data: change.data}
+		}
+
+		err := f(ids, decoders)
+		if errors.Is(err, ErrSkip) {
+			continue
+		}
+		if err != nil {
+			updateErr = multierror.Append(updateErr, err)
+			for _, change := range chunk {
+				if err := diff.markFailed(b, change.id, err); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		for _, change := range chunk {
+			if err := diff.commitChange(b, bphd, change.id, change.hash, change.data); err != nil {
+				return nil, err
+			}
+			if err := diff.applied(change.id, tx); err != nil {
+				return nil, err
+			}
+		}
+		last = chunk[len(chunk)-1].id
+		i += len(chunk)
+	}
+
+	if err := diff.finishEach(tx, start, i, last); err != nil {
+		return nil, err
+	}
+	return updateErr, nil
+}
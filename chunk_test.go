@@ -0,0 +1,80 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestDifferential_EachChunk(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_chunk")
+	defer done()
+
+	for i := 0; i < 7; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		sizes   []int
+		errFail = errors.New("fail")
+	)
+	err := diff.EachChunk(context.Background(), 3, func(ids [][]byte, decoders []Decoder) error {
+		if len(ids) != len(decoders) {
+			t.Fatalf("Expected as many decoders as IDs; got %d and %d", len(decoders), len(ids))
+		}
+		for j, d := range decoders {
+			var x IDObject
+			if err := d.Decode(&x); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(x.Object) != strconv.Itoa(len(sizes)*3+j) {
+				t.Fatalf("Expected decoder %d to decode the payload of %q; got %v", j, ids[j], x.Object)
+			}
+		}
+		sizes = append(sizes, len(ids))
+		if string(ids[0]) == "3" {
+			return errFail
+		}
+		return nil
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("Expected %q; got %v", errFail, err)
+	}
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Fatalf("Expected chunks of sizes [3 3 1]; got %v", sizes)
+	}
+
+	// The failed chunk is left pending as a whole
+	if pending := diff.CountChanges(); pending != 3 {
+		t.Fatalf("Expected 3 pending changes; got %d", pending)
+	}
+	failed, err := diff.Failed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 3 || string(failed[0]) != "3" || string(failed[2]) != "5" {
+		t.Fatalf("Expected failed IDs [3 4 5]; got %q", failed)
+	}
+}
+
+func TestDifferential_EachChunk_SkipWrapped(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_chunk_skip_wrapped")
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	err := diff.EachChunk(context.Background(), 0, func(ids [][]byte, decoders []Decoder) error {
+		return fmt.Errorf("not ready: %w", ErrSkip)
+	})
+	if err != nil {
+		t.Fatalf("Expected a wrapped ErrSkip not to be reported as an error; got %v", err)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+}
@@ -0,0 +1,150 @@
+package diffdb
+
+import (
+	"errors"
+	"github.com/boltdb/bolt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrDifferentialExists indicates that the destination of Clone already exists.
+var ErrDifferentialExists = errors.New("diffdb: differential already exists")
+
+// Clone copies the differential named src to a new differential named dst in a single transaction,
+// including its committed hashes, pending changes, failed markers, settings and user data.
+// It returns ErrNoDifferential if src does not exist and ErrDifferentialExists if dst already exists.
+func (db *DB) Clone(src, dst string) error {
+	return db.updateOp(func(tx *bolt.Tx) error {
+		from := tx.Bucket([]byte(src))
+		if from == nil {
+			return ErrNoDifferential
+		}
+		if tx.Bucket([]byte(dst)) != nil {
+			return ErrDifferentialExists
+		}
+
+		to, err := tx.CreateBucket([]byte(dst))
+		if err != nil {
+			return err
+		}
+		if err := copyBucket(to, from); err != nil {
+			return err
+		}
+
+		// The clone holds its own references to pending payloads in the shared store
+		return acquireShared(to)
+	})
+}
+
+// keyPromote is the name of the temporary bucket used by Promote while swapping differentials
+var keyPromote = []byte("_diffdb.promote")
+
+// Promote atomically swaps the contents of the differentials named staging and live in a single transaction,
+// so that a snapshot built in staging becomes live without readers of live ever observing a partial state.
+// After Promote returns, staging holds the previous contents of live, or no longer exists if live did not exist.
+// It returns ErrNoDifferential if staging does not exist.
+//
+// Differentials opened before Promote keep the settings, such as the hash algorithm, they were opened with
+// so they should be opened again if the settings of staging and live differ.
+func (db *DB) Promote(staging, live string) error {
+	return db.updateOp(func(tx *bolt.Tx) error {
+		s := tx.Bucket([]byte(staging))
+		if s == nil {
+			return ErrNoDifferential
+		}
+		if s.Bucket(bucketHashes) == nil {
+			return ErrNotDiffDB
+		}
+
+		// Move live aside so that it can become staging
+		l := tx.Bucket([]byte(live))
+		if l != nil {
+			tmp, err := tx.CreateBucket(keyPromote)
+			if err != nil {
+				return err
+			}
+			if err := copyBucket(tmp, l); err != nil {
+				return err
+			}
+			if err := tx.DeleteBucket([]byte(live)); err != nil {
+				return err
+			}
+		}
+
+		if err := moveBucket(tx, []byte(staging), []byte(live)); err != nil {
+			return err
+		}
+		if l == nil {
+			return nil
+		}
+		return moveBucket(tx, keyPromote, []byte(staging))
+	})
+}
+
+// moveBucket copies the top level bucket from to a new bucket to and deletes from.
+func moveBucket(tx *bolt.Tx, from, to []byte) error {
+	dst, err := tx.CreateBucket(to)
+	if err != nil {
+		return err
+	}
+	if err := copyBucket(dst, tx.Bucket(from)); err != nil {
+		return err
+	}
+	return tx.DeleteBucket(from)
+}
+
+// copyBucket recursively copies every key and nested bucket of from into to.
+func copyBucket(to, from *bolt.Bucket) error {
+	return from.ForEach(func(k, v []byte) error {
+		// Keys with an empty value such as conflict markers may also have a nil value
+		child := from.Bucket(k)
+		if v != nil || child == nil {
+			return to.Put(k, v)
+		}
+
+		nested, err := to.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(nested, child)
+	})
+}
+
+// Backup writes a consistent copy of the whole database, including the user data of every differential, to w.
+// The copy can be opened with New once written to a file.
+// Backup uses a read transaction so it does not block writers.
+func (db *DB) Backup(w io.Writer) (n int64, err error) {
+	err = db.db.View(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return
+}
+
+// Snapshot writes a consistent copy of the whole database to the file at path while it remains open and writable,
+// such as for scheduled hot backups. The copy is written to a temporary file in the same directory
+// which is synced and then renamed to path, so path never holds a partially written snapshot
+// and an existing file at path is only replaced once the snapshot is complete.
+// The snapshot can be opened with New.
+func (db *DB) Snapshot(path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := db.Backup(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,200 @@
+package diffdb
+
+import (
+	"bytes"
+	"github.com/boltdb/bolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDB_Clone(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.UpdateUserData(func(b *bolt.Bucket) error {
+		return b.Put([]byte("cursor"), []byte("42"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Clone("src", "dst"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Clone("src", "dst"); err != ErrDifferentialExists {
+		t.Fatalf("Expected %q; got %v", ErrDifferentialExists, err)
+	}
+	if err := db.Clone("missing", "other"); err != ErrNoDifferential {
+		t.Fatalf("Expected %q; got %v", ErrNoDifferential, err)
+	}
+
+	clone, err := db.Open("dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := clone.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+	assertUserData(t, clone, "cursor", "42")
+}
+
+func TestDB_Backup(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.UpdateUserData(func(b *bolt.Bucket) error {
+		return b.Put([]byte("cursor"), []byte("42"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := db.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir(os.TempDir(), "_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	diff, err = restored.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertUserData(t, diff, "cursor", "42")
+}
+
+func TestDB_Snapshot(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir(os.TempDir(), "_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.db")
+
+	// Snapshot twice so that the second replaces the first while the database stays open
+	for i := 0; i < 2; i++ {
+		if _, err := diff.Add(NewIDObject([]byte{byte(i)}, i)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Snapshot(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected only the snapshot in the directory; got %d files", len(entries))
+	}
+
+	snapshot, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Close()
+
+	restored, err := snapshot.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := restored.CountChanges(); pending != 2 {
+		t.Fatalf("Expected 2 pending changes in the snapshot; got %d", pending)
+	}
+}
+
+// assertUserData fails the test if the user data key of diff does not hold value.
+func assertUserData(t *testing.T, diff *Differential, key, value string) {
+	t.Helper()
+	err := diff.ViewUserData(func(b *bolt.Bucket) error {
+		if v := b.Get([]byte(key)); string(v) != value {
+			t.Fatalf("Expected user data %s to be %q; got %q", key, value, v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_Promote(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	live, err := db.Open("live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := live.Add(NewIDObject([]byte("old"), 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	staging, err := db.Open("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"new1", "new2"} {
+		if _, err := staging.Add(NewIDObject([]byte(id), id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Promote("staging", "live"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Existing handles observe the swapped contents
+	if pending := live.CountChanges(); pending != 2 {
+		t.Fatalf("Expected 2 pending changes in live; got %d", pending)
+	}
+	if pending := staging.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change in staging; got %d", pending)
+	}
+
+	if err := db.Promote("missing", "live"); err != ErrNoDifferential {
+		t.Fatalf("Expected %q; got %v", ErrNoDifferential, err)
+	}
+
+	// Promoting to a differential that does not exist moves staging
+	if err := db.Promote("staging", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Compare("staging", "other"); err != ErrNoDifferential {
+		t.Fatalf("Expected staging to no longer exist; got %v", err)
+	}
+}
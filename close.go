@@ -0,0 +1,113 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"github.com/boltdb/bolt"
+	"sync"
+)
+
+var (
+	// ErrClosed indicates that an operation was started after the database was closed or while it is closing.
+	ErrClosed = errors.New("diffdb: database is closed")
+
+	// ErrBusy indicates that CloseContext gave up waiting for in-flight operations to finish.
+	ErrBusy = errors.New("diffdb: database is busy")
+)
+
+// inflight tracks the number of in-flight operations that write to a database, such as Add and Each,
+// so that they can be drained before the database is closed.
+type inflight struct {
+	mu      sync.Mutex
+	n       int
+	closing bool
+	closed  bool
+	idle    chan struct{}
+}
+
+// begin registers the start of an operation.
+// ErrClosed is returned if the database is closed or closing.
+func (f *inflight) begin() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closing || f.closed {
+		return ErrClosed
+	}
+	f.n++
+	return nil
+}
+
+// end registers the end of an operation started with begin.
+func (f *inflight) end() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n--
+	if f.n == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+}
+
+// drain rejects new operations and waits for in-flight operations to finish.
+// If the context is done first then new operations are accepted again and ErrBusy is returned.
+func (f *inflight) drain(ctx context.Context) error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return ErrClosed
+	}
+	if f.n == 0 {
+		f.closed = true
+		f.mu.Unlock()
+		return nil
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle := f.idle
+	f.closing = true
+	f.mu.Unlock()
+
+	select {
+	case <-idle:
+		f.mu.Lock()
+		f.closed = true
+		f.mu.Unlock()
+		return nil
+	case <-ctx.Done():
+		f.mu.Lock()
+		f.closing = false
+		f.mu.Unlock()
+		return ErrBusy
+	}
+}
+
+// updateOp runs f in a write transaction as update does, registered as an in-flight operation
+// so that it returns ErrClosed once CloseContext has started.
+func (diff *Differential) updateOp(f func(tx *bolt.Tx) error) error {
+	if err := diff.ops.begin(); err != nil {
+		return err
+	}
+	defer diff.ops.end()
+	return diff.update(f)
+}
+
+// updateOp runs f in a write transaction on the database, registered as an in-flight operation
+// so that it returns ErrClosed once CloseContext has started.
+func (db *DB) updateOp(f func(tx *bolt.Tx) error) error {
+	if err := db.ops.begin(); err != nil {
+		return err
+	}
+	defer db.ops.end()
+	return db.db.Update(f)
+}
+
+// CloseContext waits for in-flight operations that write to the database, such as Add, Each and Remove,
+// to finish before closing the database file. Operations started while waiting return ErrClosed.
+// If the context is done before all operations have finished then the database is left open and ErrBusy is returned.
+func (db *DB) CloseContext(ctx context.Context) error {
+	if err := db.ops.drain(ctx); err != nil {
+		return err
+	}
+	return db.db.Close()
+}
@@ -0,0 +1,88 @@
+package diffdb
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDB_CloseContext(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("test_close")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+		result  = make(chan error)
+	)
+	go func() {
+		result <- diff.Each(context.Background(), func(id []byte, data Decoder) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := db.CloseContext(ctx); err != ErrBusy {
+		t.Fatalf("Expected %q; got %v", ErrBusy, err)
+	}
+
+	close(release)
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CloseContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("b"), 2)); err != ErrClosed {
+		t.Fatalf("Expected %q; got %v", ErrClosed, err)
+	}
+}
+
+func TestDB_CloseContext_Mutators(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("test_close_mutators")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CloseContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	id := []byte("a")
+	mutators := map[string]func() error{
+		"Remove":          func() error { return diff.Remove(id) },
+		"ForgetPrefix":    func() error { _, err := diff.ForgetPrefix(id); return err },
+		"ForgetBatch":     func() error { _, err := diff.ForgetBatch([][]byte{id}); return err },
+		"TruncatePending": diff.TruncatePending,
+		"Pin":             func() error { return diff.Pin(id) },
+		"Unpin":           func() error { return diff.Unpin(id) },
+		"Pause":           diff.Pause,
+		"Resume":          func() error { _, err := diff.Resume(); return err },
+		"Reset":           func() error { return diff.Reset(false) },
+		"PutUserValue":    func() error { return diff.PutUserValue("k", 1) },
+		"IncrUserCounter": func() error { _, err := diff.IncrUserCounter("n", 1); return err },
+		"SetMetadata":     func() error { return db.SetMetadata("test_close_mutators", Metadata{}) },
+		"Clone":           func() error { return db.Clone("test_close_mutators", "clone") },
+		"Delete":          func() error { return db.Delete("test_close_mutators") },
+	}
+	for name, f := range mutators {
+		if err := f(); err != ErrClosed {
+			t.Errorf("%s: expected %q; got %v", name, ErrClosed, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package diffdb
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// ErrUnknownCodec indicates that a payload was encoded with a codec that has not been registered with RegisterCodec
+// and no fallback decoder is set with SetFallbackDecoder.
+var ErrUnknownCodec = errors.New("diffdb: unknown payload codec")
+
+// Payload codec tags reserved by this package.
+const (
+	// CodecMsgpack is the tag of the default msgpack codec.
+	// Msgpack payloads are stored without a tag so that payloads written before codec tags existed remain readable.
+	CodecMsgpack byte = 0
+	// CodecRaw is the tag of payloads stored as-is from a []byte or a Marshaler.
+	CodecRaw byte = 1
+)
+
+// A Codec encodes objects into payloads and decodes them back in a particular format.
+type Codec interface {
+	Marshal(x interface{}) ([]byte, error)
+	Unmarshal(data []byte, x interface{}) error
+}
+
+// A FallbackDecoder decodes payloads encoded with a codec that has not been registered,
+// where tag is the codec tag stored with the payload.
+type FallbackDecoder func(tag byte, data []byte, x interface{}) error
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Codec{}
+	fallback FallbackDecoder
+)
+
+// RegisterCodec registers a payload codec under tag for use with WithCodec.
+// Every payload is stored with the tag of the codec that encoded it, and is decoded with the codec registered under that tag,
+// so differentials containing payloads written by different codecs, such as during a migration, remain readable
+// as long as every codec is registered.
+// Registering a tag that already exists replaces it. Registering a reserved tag, CodecMsgpack or CodecRaw, panics.
+func RegisterCodec(tag byte, c Codec) {
+	if tag == CodecMsgpack || tag == CodecRaw {
+		panic(fmt.Sprintf("diffdb: codec tag %d is reserved", tag))
+	}
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[tag] = c
+}
+
+// SetFallbackDecoder sets the function used to decode payloads encoded with a codec that has not been registered.
+// Without a fallback decoder such payloads fail to decode with an error wrapping ErrUnknownCodec.
+// Passing nil removes the fallback decoder.
+func SetFallbackDecoder(f FallbackDecoder) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	fallback = f
+}
+
+func lookupCodec(tag byte) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[tag]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownCodec, "diffdb: codec tag %d", tag)
+	}
+	return c, nil
+}
+
+// decodeTagged decodes data encoded by the codec registered under tag into x,
+// using the fallback decoder if no codec is registered.
+func decodeTagged(tag byte, data []byte, x interface{}) error {
+	codecsMu.RLock()
+	c, ok := codecs[tag]
+	f := fallback
+	codecsMu.RUnlock()
+
+	switch {
+	case ok:
+		return c.Unmarshal(data, x)
+	case f != nil:
+		return f(tag, data, x)
+	}
+	return errors.Wrapf(ErrUnknownCodec, "diffdb: decode payload with codec tag %d", tag)
+}
+
+// WithCodec encodes the payload of objects given to Add with the codec registered under tag instead of msgpack.
+// The codec must be registered with RegisterCodec before objects are added.
+// Objects implementing Marshaler, as well as []byte values, are still stored as-is.
+// Changing the codec does not change the hash of objects, and existing payloads are still decoded with their own codec.
+func WithCodec(tag byte) Option {
+	return func(db *DB) {
+		db.codec = tag
+	}
+}
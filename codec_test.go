@@ -0,0 +1,87 @@
+package diffdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// jsonCodec is a Codec encoding payloads as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(x interface{}) ([]byte, error) {
+	return json.Marshal(x)
+}
+
+func (jsonCodec) Unmarshal(data []byte, x interface{}) error {
+	return json.Unmarshal(data, x)
+}
+
+func TestWithCodec(t *testing.T) {
+	const codecJSON byte = 100
+	RegisterCodec(codecJSON, jsonCodec{})
+
+	db, done := openTestDB(t)
+	defer done()
+
+	// Payloads written by msgpack and by the registered codec are both readable from the same differential
+	legacy, err := db.Open("test_codec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.Add(emailObject{Id: "user/1", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.codec = codecJSON
+	diff, err := db.Open("test_codec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(emailObject{Id: "user/2", Email: "b@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	emails := make(map[string]string)
+	err = diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		var o emailObject
+		if err := data.Decode(&o); err != nil {
+			return err
+		}
+		emails[string(id)] = o.Email
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emails["user/1"] != "a@example.com" || emails["user/2"] != "b@example.com" {
+		t.Fatalf("Unexpected decoded emails %v", emails)
+	}
+}
+
+func TestSetFallbackDecoder(t *testing.T) {
+	const codecUnknown byte = 101
+	d := &msgpackDecoder{data: []byte{taggedPayload, codecUnknown, 'x'}}
+
+	var s string
+	if err := d.Decode(&s); !errors.Is(err, ErrUnknownCodec) {
+		t.Fatalf("Expected %q; got %v", ErrUnknownCodec, err)
+	}
+
+	SetFallbackDecoder(func(tag byte, data []byte, x interface{}) error {
+		if tag != codecUnknown {
+			t.Errorf("Expected codec tag %d; got %d", codecUnknown, tag)
+		}
+		*x.(*string) = string(data)
+		return nil
+	})
+	defer SetFallbackDecoder(nil)
+
+	if err := d.Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "x" {
+		t.Fatalf("Expected the fallback decoder to decode the payload; got %q", s)
+	}
+}
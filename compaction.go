@@ -0,0 +1,57 @@
+package diffdb
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+)
+
+// DefaultCompactionThreshold is the fraction of free pages in the database file
+// above which NeedsCompaction reports that the file should be compacted.
+const DefaultCompactionThreshold = 0.5
+
+// minCompactionPages is the number of pages below which a database file is never worth compacting.
+const minCompactionPages = 256
+
+// WithCompactionThreshold sets the fraction of free pages in the database file, between 0 and 1,
+// above which NeedsCompaction reports that the file should be compacted.
+// The default is DefaultCompactionThreshold.
+func WithCompactionThreshold(ratio float64) Option {
+	return func(db *DB) {
+		db.compactionThreshold = ratio
+	}
+}
+
+// NeedsCompaction reports whether the database file has accumulated enough free pages from churn,
+// such as applying and replacing many pending changes, that it is worth rewriting it into a smaller file.
+// BoltDB reuses free pages but never shrinks the file, so this is a heuristic over the page statistics:
+// the file needs compaction when the fraction of free pages exceeds the threshold set by WithCompactionThreshold.
+// Small files never need compaction. reason describes the page counts that led to the decision.
+func (db *DB) NeedsCompaction() (needed bool, reason string, err error) {
+	threshold := db.compactionThreshold
+	if threshold <= 0 {
+		threshold = DefaultCompactionThreshold
+	}
+
+	err = db.db.View(func(tx *bolt.Tx) error {
+		var (
+			stats = db.db.Stats()
+			total = int(tx.Size()) / db.db.Info().PageSize
+			free  = stats.FreePageN + stats.PendingPageN
+		)
+		if total == 0 {
+			reason = "database file is empty"
+			return nil
+		}
+
+		ratio := float64(free) / float64(total)
+		reason = fmt.Sprintf("%d of %d pages (%.0f%%) are free, threshold is %.0f%%", free, total, ratio*100, threshold*100)
+		switch {
+		case total < minCompactionPages:
+			reason = fmt.Sprintf("database file has only %d pages", total)
+		case ratio > threshold:
+			needed = true
+		}
+		return nil
+	})
+	return
+}
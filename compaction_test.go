@@ -0,0 +1,51 @@
+package diffdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestDB_NeedsCompaction(t *testing.T) {
+	db, done := openTestDB(t, WithCompactionThreshold(0.2))
+	defer done()
+
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	needed, reason, err := db.NeedsCompaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if needed {
+		t.Fatalf("Expected a new database not to need compaction; got %q", reason)
+	}
+
+	// Stage and apply large payloads so that their pages are freed
+	objs := make([]Object, 1000)
+	for i := range objs {
+		payload := make([]byte, 4096)
+		copy(payload, strconv.Itoa(i))
+		objs[i] = NewIDObject([]byte(strconv.Itoa(i)), payload)
+	}
+	if _, err := diff.AddBatch(context.Background(), objs); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.TruncatePending(); err != nil {
+		t.Fatal(err)
+	}
+	// Free pages are only released once no transaction can still read them
+	if _, err := diff.Add(NewIDObject([]byte("x"), 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	needed, reason, err = db.NeedsCompaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !needed {
+		t.Fatalf("Expected the database to need compaction; got %q", reason)
+	}
+}
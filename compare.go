@@ -0,0 +1,127 @@
+package diffdb
+
+import (
+	"bytes"
+	"errors"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	// ErrNoDifferential indicates that a named differential does not exist in the database.
+	ErrNoDifferential = errors.New("diffdb: differential does not exist")
+
+	// ErrNoSuchDifferential is an alias of ErrNoDifferential.
+	ErrNoSuchDifferential = ErrNoDifferential
+)
+
+// A DriftKind describes how a committed entry differs between two differentials.
+type DriftKind int
+
+const (
+	// OnlyInA indicates the ID is only committed in the first differential.
+	OnlyInA DriftKind = iota
+	// OnlyInB indicates the ID is only committed in the second differential.
+	OnlyInB
+	// HashMismatch indicates the ID is committed in both differentials with different hashes.
+	HashMismatch
+)
+
+func (k DriftKind) String() string {
+	switch k {
+	case OnlyInA:
+		return "only in a"
+	case OnlyInB:
+		return "only in b"
+	case HashMismatch:
+		return "hash mismatch"
+	}
+	return "unknown"
+}
+
+// Drift is a single committed entry that differs between two differentials.
+type Drift struct {
+	ID   []byte
+	Kind DriftKind
+}
+
+// CompareResult summarises the drift between the committed state of two differentials.
+type CompareResult struct {
+	OnlyInA    int
+	OnlyInB    int
+	Mismatched int
+}
+
+// InSync returns true if no drift was found.
+func (r CompareResult) InSync() bool {
+	return r.OnlyInA == 0 && r.OnlyInB == 0 && r.Mismatched == 0
+}
+
+// Compare walks the committed hashes of the differentials named a and b and counts the IDs that have drifted.
+// Use CompareEach to iterate over the drifted IDs themselves.
+func (db *DB) Compare(a, b string) (CompareResult, error) {
+	return db.CompareEach(a, b, nil)
+}
+
+// CompareEach is like Compare but also calls f for each drifted ID in ID order.
+// The ID given to f is only valid for the duration of the call.
+// If f returns an error then the comparison stops and that error is returned.
+func (db *DB) CompareEach(a, b string, f func(Drift) error) (result CompareResult, err error) {
+	err = db.db.View(func(tx *bolt.Tx) error {
+		ba, bb := tx.Bucket([]byte(a)), tx.Bucket([]byte(b))
+		if ba == nil || bb == nil {
+			return ErrNoDifferential
+		}
+
+		var (
+			ca = ba.Bucket(bucketHashes).Cursor()
+			cb = bb.Bucket(bucketHashes).Cursor()
+
+			ida, ha = ca.First()
+			idb, hb = cb.First()
+		)
+
+		for ida != nil || idb != nil {
+			var d Drift
+			switch c := compareIDs(ida, idb); {
+			case c < 0:
+				d = Drift{ID: ida, Kind: OnlyInA}
+				result.OnlyInA++
+				ida, ha = ca.Next()
+			case c > 0:
+				d = Drift{ID: idb, Kind: OnlyInB}
+				result.OnlyInB++
+				idb, hb = cb.Next()
+			default:
+				match := bytes.Compare(ha, hb) == 0
+				if !match {
+					d = Drift{ID: ida, Kind: HashMismatch}
+					result.Mismatched++
+				}
+				ida, ha = ca.Next()
+				idb, hb = cb.Next()
+				if match {
+					continue
+				}
+			}
+
+			if f != nil {
+				if err := f(d); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// compareIDs compares two cursor keys where a nil key sorts after all other keys.
+func compareIDs(a, b []byte) int {
+	switch {
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	return bytes.Compare(a, b)
+}
@@ -0,0 +1,64 @@
+package diffdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDB_Compare(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	a, err := db.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := db.Open("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apply := func(diff *Differential, objs ...Object) {
+		for _, obj := range objs {
+			if _, err := diff.Add(obj); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	apply(a, NewIDObject([]byte("1"), 1), NewIDObject([]byte("2"), 2), NewIDObject([]byte("3"), 3))
+	apply(b, NewIDObject([]byte("2"), 2), NewIDObject([]byte("3"), 4), NewIDObject([]byte("4"), 5))
+
+	var drifted []Drift
+	result, err := db.CompareEach("a", "b", func(d Drift) error {
+		drifted = append(drifted, Drift{ID: append([]byte(nil), d.ID...), Kind: d.Kind})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != (CompareResult{OnlyInA: 1, OnlyInB: 1, Mismatched: 1}) {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if result.InSync() {
+		t.Fatal("Expected differentials not to be in sync")
+	}
+
+	var expect = []Drift{{[]byte("1"), OnlyInA}, {[]byte("3"), HashMismatch}, {[]byte("4"), OnlyInB}}
+	if len(drifted) != len(expect) {
+		t.Fatalf("Expected %d drifted IDs; got %d", len(expect), len(drifted))
+	}
+	for i := range expect {
+		if string(drifted[i].ID) != string(expect[i].ID) || drifted[i].Kind != expect[i].Kind {
+			t.Fatalf("Expected drift %d to be %s %s; got %s %s", i, expect[i].ID, expect[i].Kind, drifted[i].ID, drifted[i].Kind)
+		}
+	}
+
+	if _, err := db.Compare("a", "missing"); err != ErrNoDifferential {
+		t.Fatalf("Expected %q; got %v", ErrNoDifferential, err)
+	}
+}
@@ -0,0 +1,133 @@
+package diffdb
+
+import (
+	"encoding/binary"
+	"github.com/boltdb/bolt"
+)
+
+// WithSharedContent stores the pending payloads of differentials created while the option is set
+// in a content store shared by every differential in the database, rather than in each differential.
+// Payloads are keyed by hash and reference counted, so identical objects pending in several differentials,
+// such as replicas of the same catalog, are only stored once.
+//
+// Whether a differential uses the shared store is fixed when it is created,
+// so existing differentials are not affected by this option.
+// The size reported by Gauges does not include the shared store.
+func WithSharedContent() Option {
+	return func(db *DB) {
+		db.sharedContent = true
+	}
+}
+
+var (
+	// bucketContent and bucketContentRefs are nested in the top level meta bucket
+	bucketContent     = []byte("_cs")
+	bucketContentRefs = []byte("_cr")
+
+	keyContent    = []byte("content")
+	contentShared = []byte("shared")
+)
+
+// A payloadStore holds the encoded payloads of pending changes keyed by hash.
+type payloadStore interface {
+	// Get returns the payload stored under hash, or nil if there is none.
+	Get(hash []byte) []byte
+	// Put stores data under hash, adding a reference to it.
+	Put(hash, data []byte) error
+	// Delete drops a reference to hash, removing its payload if it is no longer referenced.
+	Delete(hash []byte) error
+}
+
+// payloadsOf returns the payload store used by the differential bucket b.
+func payloadsOf(b *bolt.Bucket) payloadStore {
+	if string(b.Bucket(bucketDiffMeta).Get(keyContent)) == string(contentShared) {
+		return sharedStore{meta: b.Tx().Bucket(bucketMeta)}
+	}
+	return b.Bucket(bucketPendingHashData)
+}
+
+var _ payloadStore = sharedStore{}
+
+// sharedStore is a reference counted payloadStore shared by all differentials in a database.
+type sharedStore struct {
+	meta *bolt.Bucket
+}
+
+func (s sharedStore) Get(hash []byte) []byte {
+	data := s.meta.Bucket(bucketContent)
+	if data == nil {
+		return nil
+	}
+	return data.Get(hash)
+}
+
+func (s sharedStore) Put(hash, data []byte) error {
+	bc, err := s.meta.CreateBucketIfNotExists(bucketContent)
+	if err != nil {
+		return err
+	}
+	br, err := s.meta.CreateBucketIfNotExists(bucketContentRefs)
+	if err != nil {
+		return err
+	}
+
+	if err := bc.Put(hash, data); err != nil {
+		return err
+	}
+	return s.acquire(br, hash)
+}
+
+// acquire adds a reference to hash in the reference bucket br.
+func (s sharedStore) acquire(br *bolt.Bucket, hash []byte) error {
+	refs, _ := binary.Uvarint(br.Get(hash))
+	return br.Put(hash, encodeRefs(refs+1))
+}
+
+func (s sharedStore) Delete(hash []byte) error {
+	bc, br := s.meta.Bucket(bucketContent), s.meta.Bucket(bucketContentRefs)
+	if bc == nil || br == nil {
+		return nil
+	}
+
+	refs, _ := binary.Uvarint(br.Get(hash))
+	if refs > 1 {
+		return br.Put(hash, encodeRefs(refs-1))
+	}
+	if err := br.Delete(hash); err != nil {
+		return err
+	}
+	return bc.Delete(hash)
+}
+
+func encodeRefs(n uint64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return b[:binary.PutUvarint(b, n)]
+}
+
+// releaseShared drops the reference held by each pending change of the differential bucket b
+// if it uses the shared store. It is used before pending changes are removed in bulk.
+func releaseShared(b *bolt.Bucket) error {
+	store, ok := payloadsOf(b).(sharedStore)
+	if !ok {
+		return nil
+	}
+	return b.Bucket(bucketPendingHashes).ForEach(func(_, hash []byte) error {
+		return store.Delete(hash)
+	})
+}
+
+// acquireShared adds a reference for each pending change of the differential bucket b
+// if it uses the shared store. It is used after pending changes are copied in bulk.
+func acquireShared(b *bolt.Bucket) error {
+	store, ok := payloadsOf(b).(sharedStore)
+	if !ok {
+		return nil
+	}
+	br, err := store.meta.CreateBucketIfNotExists(bucketContentRefs)
+	if err != nil {
+		return err
+	}
+	return b.Bucket(bucketPendingHashes).ForEach(func(_, hash []byte) error {
+		return store.acquire(br, hash)
+	})
+}
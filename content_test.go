@@ -0,0 +1,87 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/boltdb/bolt"
+	"testing"
+)
+
+// countSharedContent returns the number of payloads in the shared content store of db.
+func countSharedContent(t *testing.T, db *DB) (n int) {
+	err := db.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(bucketMeta).Bucket(bucketContent); b != nil {
+			n = b.Stats().KeyN
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestWithSharedContent(t *testing.T) {
+	db, done := openTestDB(t, WithSharedContent())
+	defer done()
+
+	a, err := db.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := db.Open("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same object in two differentials, and under two IDs of the same differential
+	for _, add := range []struct {
+		diff *Differential
+		id   string
+	}{{a, "1"}, {a, "2"}, {b, "1"}} {
+		if _, err := add.diff.Add(NewIDObject([]byte(add.id), "shared")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Clone("b", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded int
+	apply := func(id []byte, data Decoder) error {
+		var obj struct {
+			Object string
+		}
+		if err := data.Decode(&obj); err != nil {
+			return err
+		}
+		decoded++
+		return nil
+	}
+
+	if err := a.EachN(context.Background(), apply, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := countSharedContent(t, db); n != 1 {
+		t.Fatalf("Expected 1 shared payload; got %d", n)
+	}
+	if err := a.Each(context.Background(), apply); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Each(context.Background(), apply); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != 3 {
+		t.Fatalf("Expected 3 decoded changes; got %d", decoded)
+	}
+
+	// The clone still references the payload until it is deleted
+	if n := countSharedContent(t, db); n != 1 {
+		t.Fatalf("Expected 1 shared payload; got %d", n)
+	}
+	if err := db.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countSharedContent(t, db); n != 0 {
+		t.Fatalf("Expected shared payloads to be released; got %d", n)
+	}
+}
@@ -2,6 +2,7 @@ package diffdb
 
 import (
 	"bytes"
+	"github.com/pkg/errors"
 	"gopkg.in/vmihailenco/msgpack.v2"
 )
 
@@ -19,6 +20,100 @@ type msgpackDecoder struct {
 }
 
 func (msg *msgpackDecoder) Decode(x interface{}) error {
+	if raw, ok := x.(*RawMessage); ok {
+		*raw = append((*raw)[:0], msg.data...)
+		return nil
+	}
+
+	if len(msg.data) > 0 && msg.data[0] == taggedPayload {
+		if len(msg.data) < 2 {
+			return errors.New("diffdb: truncated payload")
+		}
+		tag, data := msg.data[1], msg.data[2:]
+		if tag == CodecRaw {
+			return decodeRaw(data, x)
+		}
+		return errors.Wrapf(decodeTagged(tag, data, x), "diffdb: decode payload into %T", x)
+	}
+
 	r := bytes.NewReader(msg.data)
-	return msgpack.NewDecoder(r).Decode(x)
+	return errors.Wrapf(msgpack.NewDecoder(r).Decode(x), "diffdb: decode payload into %T", x)
+}
+
+// taggedPayload prefixes payloads that are not encoded with msgpack, and is followed by the tag of the codec of the payload.
+// 0xc1 is never used by the msgpack format, so it cannot be confused with the start of a msgpack payload.
+const taggedPayload = 0xc1
+
+// A Marshaler is an object that encodes its own payload.
+// Objects implementing Marshaler, as well as []byte values, are stored as-is instead of being encoded with msgpack,
+// avoiding double encoding for callers that pre-serialise their objects.
+type Marshaler interface {
+	MarshalPayload() ([]byte, error)
+}
+
+// An Unmarshaler is an object that decodes a payload created by Marshaler.
+type Unmarshaler interface {
+	UnmarshalPayload([]byte) error
+}
+
+// encodePayload encodes x for storage using the codec registered under tag.
+func encodePayload(x interface{}, tag byte) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	switch v := x.(type) {
+	case []byte:
+		data, tag = v, CodecRaw
+	case Marshaler:
+		data, err = v.MarshalPayload()
+		tag = CodecRaw
+	default:
+		if tag == CodecMsgpack {
+			raw, err := msgpack.Marshal(x)
+			if err != nil {
+				return nil, describeUnencodable(x, err)
+			}
+			return raw, nil
+		}
+		var c Codec
+		if c, err = lookupCodec(tag); err == nil {
+			data, err = c.Marshal(x)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, len(data)+2)
+	raw[0], raw[1] = taggedPayload, tag
+	copy(raw[2:], data)
+	return raw, nil
+}
+
+// decodeRaw decodes a payload that was stored as-is into x,
+// which must be a *[]byte or implement Unmarshaler.
+func decodeRaw(data []byte, x interface{}) error {
+	switch v := x.(type) {
+	case *[]byte:
+		*v = append((*v)[:0], data...)
+		return nil
+	case Unmarshaler:
+		return v.UnmarshalPayload(data)
+	}
+	return errors.Errorf("diffdb: cannot decode raw payload into %T", x)
+}
+
+var _ Decoder = RawMessage(nil)
+
+// RawMessage is a raw encoded payload that can be used to defer decoding.
+// Passing a *RawMessage to a Decoder copies the payload without decoding it,
+// so that it can be decoded later once the concrete type is known,
+// such as in a multi-type differential where the type is determined by the ID.
+type RawMessage []byte
+
+// Decode decodes the raw payload into x.
+func (m RawMessage) Decode(x interface{}) error {
+	d := msgpackDecoder{data: m}
+	return d.Decode(x)
 }
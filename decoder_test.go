@@ -0,0 +1,129 @@
+package diffdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDecoder_RawMessage(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_raw_message")
+	defer done()
+
+	if _, err := diff.Add(emailObject{Id: "user/1", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var raw RawMessage
+	err := diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		return data.Decode(&raw)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) == 0 {
+		t.Fatal("Expected raw payload to be captured")
+	}
+
+	var o emailObject
+	if err := raw.Decode(&o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Email != "a@example.com" {
+		t.Fatalf("Unexpected decoded object %+v", o)
+	}
+}
+
+type payloadObject struct {
+	id   []byte
+	data string
+}
+
+func (o payloadObject) ID() []byte {
+	return o.id
+}
+
+func (o payloadObject) MarshalPayload() ([]byte, error) {
+	return []byte(o.data), nil
+}
+
+func (o *payloadObject) UnmarshalPayload(data []byte) error {
+	o.data = string(data)
+	return nil
+}
+
+func TestDecoder_RawPayload(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_raw_payload")
+	defer done()
+
+	if err := diff.AddExpecting([]byte("bytes"), []byte("pre-serialised"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(payloadObject{id: []byte("marshaler"), data: "custom"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		switch string(id) {
+		case "bytes":
+			var b []byte
+			if err := data.Decode(&b); err != nil {
+				return err
+			}
+			if string(b) != "pre-serialised" {
+				t.Errorf("Unexpected raw bytes %q", b)
+			}
+		case "marshaler":
+			var o payloadObject
+			if err := data.Decode(&o); err != nil {
+				return err
+			}
+			if o.data != "custom" {
+				t.Errorf("Unexpected unmarshaled payload %q", o.data)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDifferential_AddPayload(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_payload")
+	defer done()
+
+	obj := emailObject{Id: "user/1", Email: "a@example.com"}
+	updated, payload, err := diff.AddPayload(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated || len(payload) == 0 {
+		t.Fatalf("Expected the payload of a staged object; got %v and %q", updated, payload)
+	}
+
+	var o emailObject
+	if err := RawMessage(payload).Decode(&o); err != nil {
+		t.Fatal(err)
+	}
+	if o != obj {
+		t.Fatalf("Expected the payload to decode to %+v; got %+v", obj, o)
+	}
+
+	err = diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		var raw RawMessage
+		if err := data.Decode(&raw); err != nil {
+			return err
+		}
+		if string(raw) != string(payload) {
+			t.Errorf("Expected the stored payload %q; got %q", payload, raw)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated, payload, err := diff.AddPayload(obj); err != nil || updated || payload != nil {
+		t.Fatalf("Expected no payload for an unchanged object; got %v, %q, %v", updated, payload, err)
+	}
+}
@@ -0,0 +1,44 @@
+package diffdb
+
+import "sync/atomic"
+
+// DedupStats counts the outcome of objects added to a differential,
+// showing how much work is saved by deduplicating unchanged objects.
+type DedupStats struct {
+	// Adds is the number of objects successfully added, whether or not they were staged.
+	Adds uint64
+	// Unchanged is the number of added objects whose hash matched their committed hash, so nothing was staged.
+	Unchanged uint64
+	// PendingHits is the number of added objects whose hash matched their pending change, so nothing was staged.
+	PendingHits uint64
+}
+
+// HitRate returns the fraction of adds that were deduplicated, or 0 if there were none.
+// A high hit rate justifies the cost of hashing, while a low hit rate may favour WithoutDedup.
+func (s DedupStats) HitRate() float64 {
+	if s.Adds == 0 {
+		return 0
+	}
+	return float64(s.Unchanged+s.PendingHits) / float64(s.Adds)
+}
+
+// dedupCounters holds the counters reported by DedupStats.
+type dedupCounters struct {
+	adds, unchanged, pendingHits uint64
+}
+
+// DedupStats returns the deduplication counters of objects added through this Differential since it was opened
+// or the counters were last reset. If reset is true then the counters are reset to zero atomically,
+// so calling DedupStats(true) on an interval yields the counts of each interval.
+// Objects added in a transaction that is later rolled back, such as with AddTx, are still counted.
+func (diff *Differential) DedupStats(reset bool) DedupStats {
+	load := atomic.LoadUint64
+	if reset {
+		load = func(addr *uint64) uint64 { return atomic.SwapUint64(addr, 0) }
+	}
+	return DedupStats{
+		Adds:        load(&diff.dedup.adds),
+		Unchanged:   load(&diff.dedup.unchanged),
+		PendingHits: load(&diff.dedup.pendingHits),
+	}
+}
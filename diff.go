@@ -5,16 +5,35 @@ import (
 	"context"
 	"github.com/boltdb/bolt"
 	"github.com/hashicorp/go-multierror"
-	"gopkg.in/vmihailenco/msgpack.v2"
+	"github.com/pkg/errors"
 	"os"
-	"errors"
-	"github.com/mitchellh/hashstructure"
-	"encoding/binary"
+	"sync/atomic"
+	"time"
 )
 
 var (
-	// ErrConflictingKey indicates that MustNotConflict() was enabled and a conflicting ID was entered into the state database.
+	// ErrConflictingKey indicates that MustNotConflict() was enabled and a conflicting ID was entered into the state database,
+	// or that MustNotConflictOn() was enabled and a conflicting key was entered.
 	ErrConflictingKey = errors.New("diffdb: multiple objects with the same ID were added in the same change version")
+
+	// ErrNotDiffDB indicates that the file given to New is a BoltDB database that was not created by diffdb,
+	// or that the name given to Open refers to a bucket that is not a differential.
+	ErrNotDiffDB = errors.New("diffdb: database file is not a diffdb database")
+
+	// ErrObjectTooLarge indicates that the encoded payload of an object given to Add exceeds the size set by WithMaxObjectSize.
+	// The returned error wraps ErrObjectTooLarge with the ID and size of the object.
+	ErrObjectTooLarge = errors.New("diffdb: object too large")
+
+	// ErrMissingHashData indicates that the stored payload of a pending change could not be found,
+	// which means the database is inconsistent.
+	ErrMissingHashData = errors.New("diffdb: missing hash data")
+
+	// ErrEmptyID is returned when adding an object with a nil or empty ID.
+	ErrEmptyID = errors.New("diffdb: object has an empty ID")
+
+	// ErrSkip can be returned by an ApplyFunc to leave a change pending without treating it as an error.
+	// Errors wrapping ErrSkip are treated the same way.
+	ErrSkip = errors.New("diffdb: skip change")
 )
 
 // An Object is a Go object passed to a differential database to track changes on.
@@ -23,47 +42,161 @@ type Object interface {
 	ID() []byte
 }
 
+// New creates a new hashing database using the given filename
+func New(path string, opts ...Option) (*DB, error) {
+	d := &DB{
+		observer: nopObserver{},
+		options:  *bolt.DefaultOptions,
+		ops:      new(inflight),
+		turns:    new(turnQueue),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
 
-
-func HashOf(x interface{}) ([]byte, error) {
-	i, err := hashstructure.Hash(x, nil)
+	db, err := bolt.Open(path, os.FileMode(0600), &d.options)
+	if isReadOnlyStorage(err) && !d.options.ReadOnly {
+		if !d.readOnlyFallback {
+			return nil, errors.Wrapf(ErrReadOnlyStorage, "diffdb: open %s: %v", path, err)
+		}
+		d.options.ReadOnly = true
+		db, err = bolt.Open(path, os.FileMode(0600), &d.options)
+	}
+	if err == bolt.ErrTimeout {
+		return nil, ErrLocked
+	}
 	if err != nil {
 		return nil, err
 	}
-	b := make([]byte, 8)
-	binary.LittleEndian.PutUint64(b, i)
-	return b, nil
-}
+	if d.allocSize > 0 {
+		db.AllocSize = d.allocSize
+	}
+	db.NoSync = d.noSync
 
-// New creates a new hashing database using the given filename
-func New(path string) (*DB, error) {
-	db, err := bolt.Open(path, os.FileMode(0600), nil)
-	if err != nil {
+	check := db.Update
+	if d.options.ReadOnly {
+		check = db.View
+	}
+	if err := check(checkMagic); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &DB{
-		db: db,
-	}, nil
+	d.db = db
+	return d, nil
+}
+
+// checkMagic validates that the database contains the diffdb magic marker.
+// If the marker is missing but every top-level bucket looks like a differential
+// (which includes an empty database) then the marker is written, unless tx is read-only.
+// Otherwise ErrNotDiffDB is returned.
+func checkMagic(tx *bolt.Tx) error {
+	if b := tx.Bucket(bucketMeta); b != nil {
+		if bytes.Compare(b.Get(keyMagic), magic) != 0 {
+			return ErrNotDiffDB
+		}
+		return nil
+	}
+
+	err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if b.Bucket(bucketHashes) == nil {
+			return ErrNotDiffDB
+		}
+		return nil
+	})
+	if err != nil || !tx.Writable() {
+		return err
+	}
+
+	b, err := tx.CreateBucket(bucketMeta)
+	if err != nil {
+		return err
+	}
+	return b.Put(keyMagic, magic)
 }
 
 var (
-	bucketHashes          = []byte("_m")
-	bucketPendingHashes   = []byte("_ph")
-	bucketPendingHashData = []byte("_pd")
-	bucketUserData        = []byte("_ud")
-	bucketKeyConflicts    = []byte("_dk")
+	bucketMeta = []byte("_diffdb")
+	keyMagic   = []byte("magic")
+	magic      = []byte("diffdb/v1")
 )
 
+var (
+	bucketHashes            = []byte("_m")
+	bucketPendingHashes     = []byte("_ph")
+	bucketPendingHashData   = []byte("_pd")
+	bucketUserData          = []byte("_ud")
+	bucketKeyConflicts      = []byte("_dk")
+	bucketFailed            = []byte("_fl")
+	bucketDiffMeta          = []byte("_dm")
+	bucketCommittedData     = []byte("_cd")
+	bucketBatchLabels       = []byte("_bl")
+	bucketRetained          = []byte("_ra")
+	bucketPinned            = []byte("_pn")
+	bucketPendingVersions   = []byte("_pv")
+	bucketCommittedVersions = []byte("_cv")
+	bucketSequence          = []byte("_sq")
+	bucketSequenceIDs       = []byte("_si")
+	bucketHeld              = []byte("_hd")
+)
+
+// idBuckets are the buckets keyed by ID that are only created when an optional feature is used
+var idBuckets = [][]byte{bucketCommittedData, bucketBatchLabels, bucketRetained, bucketPendingVersions, bucketCommittedVersions, bucketSequenceIDs, bucketHeld}
+
 // A DB is a wrapper around a BoltDB to open multiple differential buckets
 type DB struct {
-	db *bolt.DB
+	db        *bolt.DB
+	observer  Observer
+	transform func(interface{}) (interface{}, error)
+	noDedup   bool
+	maxSize   int
+	retain    bool
+	retention time.Duration
+	validator func(id []byte, d Decoder) error
+	retry     txRetry
+	ops       *inflight
+	turns     *turnQueue
+
+	versionField string
+	codec        byte
+	equal        func(a, b interface{}) (bool, error)
+	sequence     bool
+
+	// options, allocSize, noSync and readOnlyFallback are only used when opening the database
+	options          bolt.Options
+	allocSize        int
+	noSync           bool
+	readOnlyFallback bool
+
+	// sharedContent is only used when creating a differential
+	sharedContent bool
+
+	compactionThreshold float64
 }
 
 // Open opens a named differential or creates one if it does not exist.
 func (db *DB) Open(name string) (*Differential, error) {
+	diff, _, err := db.OpenCreated(name)
+	return diff, err
+}
+
+// OpenCreated is like Open but also reports whether the differential was created by this call,
+// allowing first-time setup such as seeding user data to be performed.
+func (db *DB) OpenCreated(name string) (diff *Differential, created bool, err error) {
 	q := []byte(name)
-	err := db.db.Update(func(tx *bolt.Tx) error {
+	if db.options.ReadOnly {
+		diff, err = db.openReadOnly(q)
+		return
+	}
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		// Refuse to adopt an existing bucket that is not a differential
+		b := tx.Bucket(q)
+		if b != nil && b.Bucket(bucketHashes) == nil {
+			return ErrNotDiffDB
+		}
+		created = b == nil
+
 		b, err := tx.CreateBucketIfNotExists(q)
 		if err != nil {
 			return err
@@ -85,31 +218,105 @@ func (db *DB) Open(name string) (*Differential, error) {
 		if err != nil {
 			return err
 		}
+		_, err = b.CreateBucketIfNotExists(bucketFailed)
+		if err != nil {
+			return err
+		}
+		bm, err := b.CreateBucketIfNotExists(bucketDiffMeta)
+		if err != nil {
+			return err
+		}
 
+		if created && db.sharedContent {
+			if err := bm.Put(keyContent, contentShared); err != nil {
+				return err
+			}
+		}
+		if created {
+			if err := putTombstones(b, 0); err != nil {
+				return err
+			}
+		}
+
+		diff, err = db.newDifferential(q, string(bm.Get(keyHashName)))
+		if err != nil {
+			return err
+		}
+		if err := diff.checkHashLen(b); err != nil {
+			return err
+		}
+		if bm.Get(keyHashLen) == nil {
+			return putHashLen(b, diff.hashLen)
+		}
 		return nil
 	})
 
+	if err != nil {
+		return nil, false, err
+	}
+	return
+}
+
+// newDifferential creates a Differential for the differential bucket q using the named hash algorithm.
+func (db *DB) newDifferential(q []byte, hashName string) (*Differential, error) {
+	if hashName == "" {
+		hashName = DefaultHash
+	}
+	hash, err := lookupHash(hashName)
+	if err != nil {
+		return nil, err
+	}
+	hashLen, err := probeHashLen(hash)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Differential{
-		q:  q,
-		db: db.db,
+		q:             q,
+		db:            db.db,
+		observer:      db.observer,
+		hashName:      hashName,
+		hash:          hash,
+		hashLen:       hashLen,
+		transform:     db.transform,
+		noDedup:       db.noDedup,
+		maxObjectSize: db.maxSize,
+		retain:        db.retain,
+		retention:     db.retention,
+		validator:     db.validator,
+		retry:         db.retry,
+		ops:           db.ops,
+		turns:         db.turns,
+		versionField:  db.versionField,
+		codec:         db.codec,
+		dedup:         new(dedupCounters),
+		equal:         db.equal,
+		sequence:      db.sequence,
 	}, nil
 }
 
+// TxStats returns the cumulative statistics of every committed transaction on the database,
+// such as the number of pages allocated and nodes split, which can be sampled over time to measure write amplification.
+func (db *DB) TxStats() bolt.TxStats {
+	return db.db.Stats().TxStats
+}
+
 // Delete deletes the named differential.
 func (db *DB) Delete(name string) error {
 	q := []byte(name)
-	return db.db.Update(func(tx *bolt.Tx) error {
+	return db.updateOp(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(q); b != nil && b.Bucket(bucketDiffMeta) != nil {
+			if err := releaseShared(b); err != nil {
+				return err
+			}
+		}
 		return tx.DeleteBucket(q)
 	})
 }
 
-// Close closes the database file.
+// Close closes the database file, waiting for in-flight operations that write to the database to finish.
 func (db *DB) Close() error {
-	return db.db.Close()
+	return db.CloseContext(context.Background())
 }
 
 // A Differential tracks changes between serialised Go objects.
@@ -119,6 +326,28 @@ type Differential struct {
 	cols []string
 
 	trackConflicts bool
+	conflictKey    func(Object) []byte
+	matchType      bool
+	observer       Observer
+	hashName       string
+	hash           HashFunc
+	hashLen        int
+	transform      func(interface{}) (interface{}, error)
+	noDedup        bool
+	maxObjectSize  int
+	retain         bool
+	retention      time.Duration
+	validator      func(id []byte, d Decoder) error
+	retry          txRetry
+	ops            *inflight
+	turns          *turnQueue
+	versionField   string
+	codec          byte
+	dedup          *dedupCounters
+	equal          func(a, b interface{}) (bool, error)
+	sequence       bool
+	beforeApply    BeforeApplyHook
+	afterApply     AfterApplyHook
 }
 
 func (diff *Differential) Name() string {
@@ -130,11 +359,21 @@ func (diff *Differential) Name() string {
 // have conflicting IDs.
 // Calling MustNotConflict will delete any existing conflict information.
 func (diff *Differential) MustNotConflict() error {
-	return diff.db.Update(func(tx *bolt.Tx) error {
-		tx.OnCommit(func() {
-			diff.trackConflicts = true
-		})
+	return diff.MustNotConflictOn(nil)
+}
+
+// MustNotConflictOn is like MustNotConflict but tracks duplicates of the key extracted from each object by key
+// instead of its ID.
+// This can be used to detect duplicate values of a business key, such as an email address, that differs from the ID.
+// Objects for which key returns nil are not checked for conflicts.
+// If key is nil then the ID of each object is used, which is the same as calling MustNotConflict.
+// Calling MustNotConflictOn will delete any existing conflict information.
+// The existing conflict information is deleted and recreated in a single transaction,
+// so if recreating it fails then the previous conflict information is left intact.
+func (diff *Differential) MustNotConflictOn(key func(Object) []byte) error {
+	prevTrack, prevKey := diff.trackConflicts, diff.conflictKey
 
+	err := diff.updateOp(func(tx *bolt.Tx) error {
 		b := tx.Bucket(diff.q)
 		cb := b.Bucket(bucketKeyConflicts)
 		if cb != nil {
@@ -145,85 +384,257 @@ func (diff *Differential) MustNotConflict() error {
 		}
 
 		_, err := b.CreateBucket(bucketKeyConflicts)
-		return err
+		if err != nil {
+			return err
+		}
+
+		// Enable tracking while the write lock is still held so that any Add
+		// that follows is guaranteed to observe it
+		diff.trackConflicts = true
+		diff.conflictKey = key
+		return nil
 	})
+	if err != nil {
+		diff.trackConflicts, diff.conflictKey = prevTrack, prevKey
+	}
+	return err
 }
 
 // AddTx adds an object to start tracking by using an existing BoltDB transaction.
 func (diff *Differential) AddTx(tx *bolt.Tx, obj Object) (bool, error) {
+	status, err := diff.addTxStatus(tx, obj)
+	return status != addUnchanged, err
+}
+
+// addTxStatus adds obj within tx, notifying the observer of the outcome.
+func (diff *Differential) addTxStatus(tx *bolt.Tx, obj Object) (addStatus, error) {
+	status, _, err := diff.stage(tx, obj.ID(), obj, nil, nil)
+	return status, err
+}
+
+// stage adds x under id within tx, notifying the observer of the outcome.
+// If hash is not nil then it is used as the content hash of x instead of hashing x.
+// If check is not nil then it is called with the committed hash of id (or nil if there is none)
+// and any error it returns prevents x from being staged.
+// The payload stored for x is returned, or nil if x was not staged because it is unchanged.
+func (diff *Differential) stage(tx *bolt.Tx, id []byte, x interface{}, hash []byte, check func(committed []byte) error) (addStatus, []byte, error) {
+	status, payload, err := diff.addTx(tx, id, x, hash, check)
+	if err != nil {
+		diff.observer.ObserveError(diff.Name(), err)
+		return addUnchanged, nil, err
+	}
+
+	atomic.AddUint64(&diff.dedup.adds, 1)
+	diff.observer.ObserveAdd(diff.Name(), status != addUnchanged)
+	return status, payload, nil
+}
+
+// addStatus describes the outcome of adding a single object to a differential
+type addStatus int
+
+const (
+	// addUnchanged indicates the object was identical to its committed or pending version
+	addUnchanged addStatus = iota
+	// addCreated indicates the object has no committed version
+	addCreated
+	// addUpdated indicates the object differs from its committed version
+	addUpdated
+)
+
+func (diff *Differential) addTx(tx *bolt.Tx, id []byte, x interface{}, hash []byte, check func(committed []byte) error) (addStatus, []byte, error) {
 	b := tx.Bucket(diff.q)
 
 	var (
 		bh   = b.Bucket(bucketHashes)
 		bph  = b.Bucket(bucketPendingHashes)
-		bphd = b.Bucket(bucketPendingHashData)
+		bphd = payloadsOf(b)
 	)
 
-	id := obj.ID()
+	obj, _ := x.(Object)
+
+	// Normalise the object before anything else so that equivalent objects are treated identically
+	if diff.transform != nil {
+		var err error
+		x, err = diff.transform(x)
+		if err != nil {
+			return addUnchanged, nil, err
+		}
+		if o, ok := x.(Object); ok {
+			obj = o
+			id = o.ID()
+		}
+	}
+
+	// Empty IDs are valid BoltDB keys but would collapse every such object into a single entry
+	if len(id) == 0 {
+		return addUnchanged, nil, ErrEmptyID
+	}
+
+	if err := diff.checkType(b, x); err != nil {
+		return addUnchanged, nil, err
+	}
 
-	// Check ID conflicts
+	// Check key conflicts
+	var (
+		conflictKey []byte
+		bkc         *bolt.Bucket
+	)
 	if diff.trackConflicts {
-		bkc := b.Bucket(bucketKeyConflicts)
-		if bkc.Get(id) != nil {
-			return false, ErrConflictingKey
+		switch {
+		case diff.conflictKey == nil:
+			conflictKey = id
+		case obj != nil:
+			conflictKey = diff.conflictKey(obj)
+		}
+
+		// The conflict bucket may have been removed since tracking was enabled,
+		// for example if the differential was deleted and recreated
+		var err error
+		bkc, err = b.CreateBucketIfNotExists(bucketKeyConflicts)
+		if err != nil {
+			return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: create conflict bucket for id %x", id)
+		}
+		if conflictKey != nil && bkc.Get(conflictKey) != nil {
+			return addUnchanged, nil, ErrConflictingKey
 		}
 	}
 
-	hash, err := HashOf(obj)
-	if err != nil {
-		return false, err
+	if hash == nil {
+		var err error
+		hash, err = diff.hash(x)
+		if err != nil {
+			return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: hash object for id %x", id)
+		}
 	}
 
 	var (
 		existing = bh.Get(id)
 		match    = bytes.Compare(existing, hash) == 0
 	)
+	if isTombstone(existing) {
+		return addUnchanged, nil, deletedError(id)
+	}
+
+	if check != nil {
+		if err := check(existing); err != nil {
+			return addUnchanged, nil, err
+		}
+	}
+
+	// Changes to a paused differential are held until it is resumed
+	if isPaused(b) {
+		raw, err := diff.encode(id, x)
+		if err != nil {
+			return addUnchanged, nil, err
+		}
+		if err := holdChange(b, id, hash, raw); err != nil {
+			return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: hold change for id %x", id)
+		}
+		if bkc != nil && conflictKey != nil {
+			if err := bkc.Put(conflictKey, nil); err != nil {
+				return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: store conflict key for id %x", id)
+			}
+		}
+		return addUnchanged, nil, nil
+	}
+
+	var version []byte
+	if diff.versionField != "" {
+		var err error
+		if version, err = versionOf(x, diff.versionField); err != nil {
+			return addUnchanged, nil, err
+		}
+		if err := checkVersion(b, id, version); err != nil {
+			return addUnchanged, nil, err
+		}
+	}
+
+	// Objects with different hashes may still be equivalent to their committed version
+	if !match && !diff.noDedup && diff.equal != nil && existing != nil {
+		equal, err := diff.equalCommitted(b, id, x)
+		if err != nil {
+			return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: compare object for id %x", id)
+		}
+		match = equal
+	}
 
 	// An existing committed hash is identical, no need for changes
-	if match {
-		return false, nil
+	if match && !diff.noDedup {
+		atomic.AddUint64(&diff.dedup.unchanged, 1)
+		return addUnchanged, nil, nil
 	}
 
 	// Check if pending hash already exists
 	if pending := bph.Get(id); pending != nil {
 
 		// Contents are identical to existing pending version, no need for changes
-		if len(pending) > 0 && bytes.Compare(pending, hash) == 0 {
-			return false, nil
+		if len(pending) > 0 && bytes.Compare(pending, hash) == 0 && !diff.noDedup {
+			atomic.AddUint64(&diff.dedup.pendingHits, 1)
+			return addUnchanged, nil, nil
 		}
 
 		if err := bphd.Delete(pending); err != nil {
-			return false, err
+			return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: delete previous payload for id %x", id)
 		}
 	}
 
-	// Ensure this ID is ready to be tracked
-	if err := bph.Put(id, hash); err != nil {
-		return false, err
+	raw, err := diff.encode(id, x)
+	if err != nil {
+		return addUnchanged, nil, err
 	}
 
-	raw, err := msgpack.Marshal(obj)
-	if err != nil {
-		return false, err
+	// Ensure this ID is ready to be tracked
+	if err := bph.Put(id, hash); err != nil {
+		return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: store hash for id %x", id)
 	}
 	if err := bphd.Put(hash, raw); err != nil {
-		return false, err
+		return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: store payload for id %x", id)
+	}
+	if version != nil {
+		if err := stageVersion(b, id, version); err != nil {
+			return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: store version for id %x", id)
+		}
+	}
+	if diff.sequence {
+		if err := assignSequence(b, id); err != nil {
+			return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: assign sequence number for id %x", id)
+		}
 	}
 
-	if diff.trackConflicts {
-		err := b.Bucket(bucketKeyConflicts).Put(id, nil)
+	if bkc != nil && conflictKey != nil {
+		err := bkc.Put(conflictKey, nil)
 		if err != nil {
-			return false, err
+			return addUnchanged, nil, errors.Wrapf(err, "diffdb: Add: store conflict key for id %x", id)
 		}
 	}
 
-	return true, nil
+	if existing == nil {
+		return addCreated, raw, nil
+	}
+	return addUpdated, raw, nil
+}
+
+// encode encodes the payload of x added under id, checking that it does not exceed the maximum object size.
+func (diff *Differential) encode(id []byte, x interface{}) ([]byte, error) {
+	raw, err := encodePayload(x, diff.codec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "diffdb: Add: marshal payload for id %x", id)
+	}
+	if diff.maxObjectSize > 0 && len(raw) > diff.maxObjectSize {
+		return nil, errors.Wrapf(ErrObjectTooLarge, "diffdb: Add: object %x is %d bytes, exceeding the maximum of %d", id, len(raw), diff.maxObjectSize)
+	}
+	return raw, nil
 }
 
 // AddChan adds objects sent from a channel until the channel is closed, the object is nil,  or the context is cancelled.
 // AddChan may stop processing the stream if an error occurs in which case no more messages will be consumed
 // and that error will be returned.
 func (diff *Differential) AddChan(ctx context.Context, stream <-chan Object) error {
+	if err := diff.ops.begin(); err != nil {
+		return err
+	}
+	defer diff.ops.end()
+
 	tx, err := diff.db.Begin(true)
 	if err != nil {
 		return err
@@ -260,8 +671,17 @@ func (diff *Differential) AddChan(ctx context.Context, stream <-chan Object) err
 //
 // If Add is called multiple times same ID before applying changes then
 // only the latest change will be taken to be applied.
+//
+// Add hashes obj once and only stages it if it differs from the committed and pending versions of its ID,
+// returning whether it was staged, so there is no need to call Changed before Add.
 func (diff *Differential) Add(obj Object) (updated bool, err error) {
-	err = diff.db.Update(func(tx *bolt.Tx) error {
+	if err = diff.ops.begin(); err != nil {
+		return
+	}
+	defer diff.ops.end()
+
+	err = diff.update(func(tx *bolt.Tx) error {
+		diff.observeTxStats(tx, "add")
 		var e error
 		updated, e = diff.AddTx(tx, obj)
 		return e
@@ -269,16 +689,47 @@ func (diff *Differential) Add(obj Object) (updated bool, err error) {
 	return
 }
 
+// Upsert is an alias of Add for the check-then-stage idiom: it stages obj only if it has changed,
+// returning whether it was staged. Add already hashes obj once and compares it with the committed
+// and pending hashes of its ID, so neither Add nor Upsert needs Changed to be called first.
+func (diff *Differential) Upsert(obj Object) (changed bool, err error) {
+	return diff.Add(obj)
+}
+
+// AddPayload is like Add but also returns the payload stored for obj, so that an object that is both staged
+// and sent elsewhere does not need to be encoded twice.
+// The payload is the exact bytes persisted by the differential: the msgpack encoding of obj,
+// or if obj is a []byte, implements Marshaler or WithCodec is used, a codec tag followed by the encoded object.
+// It can be decoded with RawMessage. If obj is unchanged then nothing is stored and the payload is nil.
+func (diff *Differential) AddPayload(obj Object) (updated bool, payload []byte, err error) {
+	if err = diff.ops.begin(); err != nil {
+		return
+	}
+	defer diff.ops.end()
+
+	err = diff.update(func(tx *bolt.Tx) error {
+		diff.observeTxStats(tx, "add")
+		status, p, err := diff.stage(tx, obj.ID(), obj, nil, nil)
+		updated, payload = status != addUnchanged, p
+		return err
+	})
+	return
+}
+
 // Changed returns true if the hash of x has changed for its ID.
+// If the ID was deleted with Remove then an error wrapping ErrDeleted is returned.
 func (diff *Differential) Changed(id []byte, x interface{}) (changed bool, err error) {
 	var hash []byte
-	hash, err = HashOf(x)
+	hash, err = diff.hash(x)
 	if err != nil {
 		return
 	}
 
 	err = diff.db.View(func(tx *bolt.Tx) error {
 		var compare = tx.Bucket(diff.q).Bucket(bucketHashes).Get(id)
+		if isTombstone(compare) {
+			return deletedError(id)
+		}
 		changed = bytes.Compare(compare, hash) != 0
 		return nil
 	})
@@ -289,49 +740,189 @@ func (diff *Differential) Changed(id []byte, x interface{}) (changed bool, err e
 // In other words, this is the amount of all items tracked by the differential db.
 func (diff *Differential) CountTracking() (count int) {
 	diff.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(diff.q)
-		count = b.Bucket(bucketHashes).Stats().KeyN
+		count = diff.CountTrackingTx(tx)
 		return nil
 	})
 
 	return
 }
 
+// CountTrackingTx is like CountTracking but counts within tx,
+// such as one given to ViewUserDataTx or UpdateUserDataTx.
+func (diff *Differential) CountTrackingTx(tx *bolt.Tx) int {
+	return tx.Bucket(diff.q).Bucket(bucketHashes).Stats().KeyN
+}
+
 // CountChanges returns the number of items in the change pending bucket.
 func (diff *Differential) CountChanges() (pending int) {
 	diff.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(diff.q)
-		pending = b.Bucket(bucketPendingHashes).Stats().KeyN
+		pending = diff.CountChangesTx(tx)
 		return nil
 	})
 
 	return
 }
 
-// ApplyFunc is a function to be called to apply each pending change
+// CountChangesTx is like CountChanges but counts within tx,
+// such as one given to ViewUserDataTx or UpdateUserDataTx.
+func (diff *Differential) CountChangesTx(tx *bolt.Tx) int {
+	return tx.Bucket(diff.q).Bucket(bucketPendingHashes).Stats().KeyN
+}
+
+// CountChangesByType breaks down the pending changes into creates of IDs without a committed hash
+// and updates of IDs with a committed hash, without loading any payloads, so creates+updates equals CountChanges.
+// Deletes are not pending changes: Remove records a deletion immediately,
+// so deletes is the number of IDs currently marked as deleted by Remove, which is kept as a count rather than scanned.
+func (diff *Differential) CountChangesByType() (creates, updates, deletes int, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		var (
+			b  = tx.Bucket(diff.q)
+			bh = b.Bucket(bucketHashes)
+		)
+
+		deletes = countTombstones(b)
+		return b.Bucket(bucketPendingHashes).ForEach(func(id, _ []byte) error {
+			if bh.Get(id) == nil {
+				creates++
+			} else {
+				updates++
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// Reset clears all tracked hashes, pending changes and failed markers from the differential
+// so that it can be resynchronised from scratch, while keeping the differential itself open.
+// If keepUserData is false then the user data bucket is cleared too.
+func (diff *Differential) Reset(keepUserData bool) error {
+	return diff.updateOp(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diff.q)
+
+		if err := releaseShared(b); err != nil {
+			return err
+		}
+
+		names := [][]byte{bucketHashes, bucketPendingHashes, bucketPendingHashData, bucketFailed}
+		if b.Bucket(bucketKeyConflicts) != nil {
+			names = append(names, bucketKeyConflicts)
+		}
+		if bsq := b.Bucket(bucketSequence); bsq != nil {
+			names = append(names, bucketSequence)
+		}
+		for _, name := range idBuckets {
+			if b.Bucket(name) != nil {
+				names = append(names, name)
+			}
+		}
+		if !keepUserData {
+			names = append(names, bucketUserData)
+		}
+
+		for _, name := range names {
+			if err := b.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := b.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return putTombstones(b, 0)
+	})
+}
+
+// ApplyFunc is a function to be called to apply each pending change.
+// If it returns ErrSkip then the change is left pending and is not reported as an error.
 type ApplyFunc func(id []byte, data Decoder) error
 
+func (f ApplyFunc) apply(id []byte, _ ChangeMeta, data Decoder, _ *bolt.Tx) error {
+	return f(id, data)
+}
+
+// applyFunc is the internal form of each kind of apply function used by eachTx.
+type applyFunc func(id []byte, meta ChangeMeta, data Decoder, tx *bolt.Tx) error
+
 // EachN scans through each change until N items have been processed.
 // If n is <= 0 then all pending changes will be applied.
 func (diff *Differential) EachN(ctx context.Context, f ApplyFunc, n int) error {
-	tx, err := diff.db.Begin(true)
+	return diff.each(ctx, f.apply, n, openPendingCursor)
+}
+
+// openPendingCursor opens a cursor over all pending changes in ID order.
+func openPendingCursor(b *bolt.Bucket) (changeCursor, error) {
+	return b.Bucket(bucketPendingHashes).Cursor(), nil
+}
+
+// A changeCursor iterates over pending changes yielding the ID and pending hash of each change.
+type changeCursor interface {
+	First() (id []byte, hash []byte)
+	Next() (id []byte, hash []byte)
+}
+
+// each applies f to each change yielded by the cursor returned from open until n items have been processed
+// in a new transaction.
+func (diff *Differential) each(ctx context.Context, f applyFunc, n int, open func(b *bolt.Bucket) (changeCursor, error)) error {
+	return diff.eachOutcome(ctx, f, n, open, nil)
+}
+
+// eachOutcome is like each but records the outcome of each change in out if it is not nil.
+func (diff *Differential) eachOutcome(ctx context.Context, f applyFunc, n int, open func(b *bolt.Bucket) (changeCursor, error), out *EachOutcome) error {
+	if err := diff.ops.begin(); err != nil {
+		return err
+	}
+	defer diff.ops.end()
+
+	var updateErr *multierror.Error
+	err := diff.retry.do(func() (bool, error) {
+		tx, err := diff.db.Begin(true)
+		if err != nil {
+			return true, err
+		}
+		defer tx.Rollback()
+		diff.observeTxStats(tx, "each")
+
+		if out != nil {
+			// Outcomes of a rolled back attempt are discarded along with its changes
+			*out = EachOutcome{}
+		}
+		updateErr, err = diff.eachTx(ctx, tx, f, n, open, out)
+		if err != nil {
+			return false, err
+		}
+		return true, errors.Wrap(tx.Commit(), "diffdb: Each: commit")
+	})
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+
+	return updateErr.ErrorOrNil()
+}
+
+// eachTx applies f to each change yielded by the cursor returned from open until n items have been processed.
+// Changes that fail to apply are marked as failed, and the failed marker is cleared on success.
+// Errors returned by f are accumulated in the returned multierror,
+// while database errors are returned directly and leave tx in an undefined state.
+// If out is not nil the ID of each applied and failed change is recorded in it.
+func (diff *Differential) eachTx(ctx context.Context, tx *bolt.Tx, f applyFunc, n int, open func(b *bolt.Bucket) (changeCursor, error), out *EachOutcome) (*multierror.Error, error) {
+	start := time.Now()
 
 	b := tx.Bucket(diff.q)
 	var (
 		bh   = b.Bucket(bucketHashes)
-		bph  = b.Bucket(bucketPendingHashes)
-		bphd = b.Bucket(bucketPendingHashData)
+		bphd = payloadsOf(b)
 
 		decoder = new(msgpackDecoder)
-		cur     = bph.Cursor()
 	)
 
+	cur, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+
 	var updateErr *multierror.Error
 	var i int
+	var last []byte
 
 scan:
 	for id, hash := cur.First(); id != nil; id, hash = cur.Next() {
@@ -344,23 +935,44 @@ scan:
 
 		var data = bphd.Get(hash)
 		if data == nil {
-			panic("missing hash data")
+			return nil, errors.Wrapf(ErrMissingHashData, "diffdb: Each: id %x", id)
 		}
 
 		decoder.data = data
-		if err := f(id, decoder); err != nil {
+		var previous = bh.Get(id)
+
+		// Changes that fail validation or are vetoed are never given to f and follow the same path as a failed change
+		err := diff.vet(id, decoder, tx)
+		if err == nil {
+			err = f(id, ChangeMeta{
+				Hash:     hash,
+				Previous: previous,
+				Created:  previous == nil,
+			}, decoder, tx)
+		}
+		if errors.Is(err, ErrSkip) {
+			continue
+		}
+		if err != nil {
 			updateErr = multierror.Append(updateErr, err)
+			if err := diff.markFailed(b, id, err); err != nil {
+				return nil, err
+			}
+			if out != nil {
+				out.Failed = append(out.Failed, ChangeError{ID: append([]byte(nil), id...), Err: err})
+			}
 			continue
 		}
 
-		if err := bh.Put(id, hash); err != nil {
-			return err
+		if err := diff.commitChange(b, bphd, id, hash, data); err != nil {
+			return nil, err
 		}
-		if err := bph.Delete(id); err != nil {
-			return err
+		if err := diff.applied(id, tx); err != nil {
+			return nil, err
 		}
-		if err := bphd.Delete(hash); err != nil {
-			return err
+		last = append(last[:0], id...)
+		if out != nil {
+			out.Applied = append(out.Applied, append([]byte(nil), id...))
 		}
 		i ++
 		if n > 0 && n == i {
@@ -368,10 +980,91 @@ scan:
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return err
+	if err := diff.finishEach(tx, start, i, last); err != nil {
+		return nil, err
 	}
+	return updateErr, nil
+}
 
+// markFailed marks the pending change of id in b as failed with err, notifying the observer.
+func (diff *Differential) markFailed(b *bolt.Bucket, id []byte, err error) error {
+	diff.observer.ObserveError(diff.Name(), err)
+	return errors.Wrapf(b.Bucket(bucketFailed).Put(id, []byte(err.Error())), "diffdb: mark id %x as failed", id)
+}
+
+// commitChange commits the pending change of id with the given hash and payload data in b,
+// removing it from the pending changes.
+func (diff *Differential) commitChange(b *bolt.Bucket, bphd payloadStore, id, hash, data []byte) error {
+	if err := b.Bucket(bucketHashes).Put(id, hash); err != nil {
+		return errors.Wrapf(err, "diffdb: Each: commit hash for id %x", id)
+	}
+	if diff.retain {
+		bcd, err := b.CreateBucketIfNotExists(bucketCommittedData)
+		if err != nil {
+			return errors.Wrap(err, "diffdb: Each: create committed payload bucket")
+		}
+		if err := bcd.Put(id, append([]byte(nil), data...)); err != nil {
+			return errors.Wrapf(err, "diffdb: Each: retain committed payload for id %x", id)
+		}
+	}
+	if err := commitVersion(b, id); err != nil {
+		return errors.Wrapf(err, "diffdb: Each: commit version for id %x", id)
+	}
+	if err := releaseSequence(b, id); err != nil {
+		return errors.Wrapf(err, "diffdb: Each: release sequence number for id %x", id)
+	}
+	if diff.retention > 0 {
+		if err := retainApplied(b, id, data, time.Now()); err != nil {
+			return errors.Wrapf(err, "diffdb: Each: retain applied payload for id %x", id)
+		}
+	}
+	if err := b.Bucket(bucketPendingHashes).Delete(id); err != nil {
+		return errors.Wrapf(err, "diffdb: Each: delete pending change for id %x", id)
+	}
+	if err := bphd.Delete(hash); err != nil {
+		return errors.Wrapf(err, "diffdb: Each: delete payload for id %x", id)
+	}
+	if err := b.Bucket(bucketFailed).Delete(id); err != nil {
+		return errors.Wrapf(err, "diffdb: Each: clear failed marker for id %x", id)
+	}
+	return nil
+}
+
+// finishEach records the outcome of applying n changes within tx starting at start,
+// where last is the ID of the last change applied.
+func (diff *Differential) finishEach(tx *bolt.Tx, start time.Time, n int, last []byte) error {
+	b := tx.Bucket(diff.q)
+	if last != nil {
+		if err := b.Bucket(bucketUserData).Put(keyResume, last); err != nil {
+			return errors.Wrap(err, "diffdb: Each: store resume point")
+		}
+	}
+	if err := recordRun(b.Bucket(bucketUserData), start, n); err != nil {
+		return errors.Wrap(err, "diffdb: Each: record run")
+	}
+
+	tx.OnCommit(func() {
+		diff.observer.ObserveApply(diff.Name(), n, time.Since(start))
+	})
+	return nil
+}
+
+// ApplyTxFunc is a function to be called to apply each pending change within the transaction given to EachTx.
+type ApplyTxFunc func(id []byte, data Decoder, tx *bolt.Tx) error
+
+func (f ApplyTxFunc) apply(id []byte, _ ChangeMeta, data Decoder, tx *bolt.Tx) error {
+	return f(id, data, tx)
+}
+
+// EachTx is like Each but applies changes within the caller-provided writable transaction tx instead of starting its own.
+// f is given tx so that downstream writes to other buckets are committed atomically with the differential's hashes.
+// The caller is responsible for committing or rolling back tx;
+// if tx is rolled back then none of the changes are considered applied.
+func (diff *Differential) EachTx(ctx context.Context, tx *bolt.Tx, f ApplyTxFunc) error {
+	updateErr, err := diff.eachTx(ctx, tx, f.apply, -1, openPendingCursor, nil)
+	if err != nil {
+		return err
+	}
 	return updateErr.ErrorOrNil()
 }
 
@@ -389,11 +1082,32 @@ func (diff *Differential) ViewUserData(f func(b *bolt.Bucket) error) error {
 	})
 }
 
+// ViewUserDataTx is like ViewUserData but also gives f the view transaction,
+// so that user data and other state of the differential, such as CountTrackingTx,
+// or other buckets in the database can be read from a single consistent snapshot.
+// The differential's own buckets must not be modified through tx.
+func (diff *Differential) ViewUserDataTx(f func(tx *bolt.Tx, b *bolt.Bucket) error) error {
+	return diff.db.View(func(tx *bolt.Tx) error {
+		return f(tx, tx.Bucket(diff.q).Bucket(bucketUserData))
+	})
+}
+
 // UpdateUserData wraps a BoltDB update transaction to allow custom user data to viewed or updated
 // in the differential database.
+// If WithTxRetry is used then f may be called again if the transaction fails to commit.
 func (diff *Differential) UpdateUserData(f func(b *bolt.Bucket) error) error {
-	return diff.db.Update(func(tx *bolt.Tx) error {
+	return diff.updateOp(func(tx *bolt.Tx) error {
 		b := tx.Bucket(diff.q).Bucket(bucketUserData)
 		return f(b)
 	})
 }
+
+// UpdateUserDataTx is like UpdateUserData but also gives f the update transaction,
+// so that user data can be updated atomically with other buckets in the database.
+// The differential's own buckets, other than the user data bucket, must not be modified through tx.
+// If WithTxRetry is used then f may be called again if the transaction fails to commit.
+func (diff *Differential) UpdateUserDataTx(f func(tx *bolt.Tx, b *bolt.Bucket) error) error {
+	return diff.updateOp(func(tx *bolt.Tx) error {
+		return f(tx, tx.Bucket(diff.q).Bucket(bucketUserData))
+	})
+}
@@ -10,7 +10,9 @@ import (
 	"testing"
 	"time"
 	"strconv"
+	"strings"
 	"github.com/hashicorp/go-multierror"
+	"github.com/boltdb/bolt"
 )
 
 func NewIDObject(id []byte, o interface{}) IDObject {
@@ -177,6 +179,39 @@ func TestDifferential_Add(t *testing.T) {
 	}
 }
 
+func TestDifferential_Upsert(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_upsert")
+	defer done()
+
+	steps := []struct {
+		value   int
+		apply   bool
+		changed bool
+	}{
+		{value: 1, changed: true},
+		{value: 1, apply: true},
+		{value: 1},
+		{value: 2, changed: true},
+	}
+	for i, s := range steps {
+		changed, err := diff.Upsert(NewIDObject([]byte("a"), s.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != s.changed {
+			t.Fatalf("step %d: Expected changed %v; got %v", i, s.changed, changed)
+		}
+		if s.apply {
+			if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+}
+
 type IDMapper struct {
 	id []byte
 }
@@ -222,6 +257,188 @@ func TestDifferential_MustNotConflict(t *testing.T) {
 	}
 }
 
+// Test that Add does not panic if the conflict bucket is removed after conflict tracking is enabled.
+func TestDifferential_MustNotConflict_MissingBucket(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.MustNotConflict(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Delete("test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Open("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := diff.Add(IDMapper{id: []byte("1")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(IDMapper{id: []byte("1")}); err != ErrConflictingKey {
+		t.Fatalf("Expected %q as error; got %v", ErrConflictingKey, err)
+	}
+}
+
+type emailObject struct {
+	Id    string
+	Email string
+}
+
+func (o emailObject) ID() []byte {
+	return []byte(o.Id)
+}
+
+func TestDifferential_MustNotConflictOn(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	err := diff.MustNotConflictOn(func(obj Object) []byte {
+		return []byte(obj.(emailObject).Email)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := diff.Add(emailObject{Id: "1", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(emailObject{Id: "2", Email: "b@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = diff.Add(emailObject{Id: "3", Email: "a@example.com"})
+	if err != ErrConflictingKey {
+		t.Fatalf("Expected %q as error; got %v", ErrConflictingKey, err)
+	}
+}
+
+// Test that conflict tracking is in effect for an Add made by another goroutine as soon as MustNotConflictOn returns.
+func TestDifferential_MustNotConflictOn_AddAfter(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	if _, err := diff.Add(emailObject{Id: "1", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	err := diff.MustNotConflictOn(func(obj Object) []byte {
+		return []byte(obj.(emailObject).Email)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		for _, id := range []string{"2", "3"} {
+			_, err := diff.Add(emailObject{Id: id, Email: "b@example.com"})
+			errs <- err
+		}
+	}()
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != ErrConflictingKey {
+		t.Fatalf("Expected %q as error; got %v", ErrConflictingKey, err)
+	}
+}
+
+func TestDifferential_Reset(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_reset")
+	defer done()
+
+	for i := 0; i < 4; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.EachN(context.Background(), func(id []byte, data Decoder) error { return nil }, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	err := diff.UpdateUserData(func(b *bolt.Bucket) error {
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := diff.Reset(true); err != nil {
+		t.Fatal(err)
+	}
+	if tracking := diff.CountTracking(); tracking != 0 {
+		t.Fatalf("Expected nothing to be tracked; got %d", tracking)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected nothing to be pending; got %d", pending)
+	}
+
+	var value []byte
+	diff.ViewUserData(func(b *bolt.Bucket) error {
+		value = b.Get([]byte("key"))
+		return nil
+	})
+	if string(value) != "value" {
+		t.Fatalf("Expected user data to be kept; got %q", value)
+	}
+
+	if err := diff.Reset(false); err != nil {
+		t.Fatal(err)
+	}
+	diff.ViewUserData(func(b *bolt.Bucket) error {
+		value = b.Get([]byte("key"))
+		return nil
+	})
+	if value != nil {
+		t.Fatalf("Expected user data to be cleared; got %q", value)
+	}
+}
+
+func TestWithTransform(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_transform", WithTransform(func(x interface{}) (interface{}, error) {
+		o := x.(emailObject)
+		o.Email = strings.ToLower(strings.TrimSpace(o.Email))
+		return o, nil
+	}))
+	defer done()
+
+	err := diff.MustNotConflictOn(func(obj Object) []byte {
+		return []byte(obj.(emailObject).Email)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := diff.Add(emailObject{Id: "1", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.MustNotConflictOn(func(obj Object) []byte { return []byte(obj.(emailObject).Email) }); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := diff.Add(emailObject{Id: "1", Email: " A@Example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated {
+		t.Fatal("Expected normalised object to be unchanged")
+	}
+
+	if _, err := diff.Add(emailObject{Id: "2", Email: "B@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(emailObject{Id: "3", Email: "b@example.com "}); err != ErrConflictingKey {
+		t.Fatalf("Expected %q as error; got %v", ErrConflictingKey, err)
+	}
+}
+
 // Test that when a context is cancelled the currently applied changes up that point are
 // still committed to the database.
 func TestDifferential_Each_ContextCommit(t *testing.T) {
@@ -305,3 +522,178 @@ func BenchmarkHash(b *testing.B) {
 		}
 	}
 }
+
+func TestNew_NotDiffDB(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "other.db")
+	other, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = other.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("plain"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	other.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = New(path)
+	if err != ErrNotDiffDB {
+		t.Fatalf("Expected %q; got %v", ErrNotDiffDB, err)
+	}
+}
+
+func TestNew_Reopen(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.db")
+	db, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Open("test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Open(string(bucketMeta)); err != ErrNotDiffDB {
+		t.Fatalf("Expected %q opening the meta bucket; got %v", ErrNotDiffDB, err)
+	}
+	db.Close()
+
+	db, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+}
+
+func TestDB_OpenCreated(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	_, created, err := db.OpenCreated("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Fatal("Expected differential to be created")
+	}
+
+	_, created, err = db.OpenCreated("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Fatal("Expected existing differential to be opened")
+	}
+}
+
+func TestDifferential_Add_EmptyID(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	for _, id := range [][]byte{nil, {}} {
+		if _, err := diff.Add(NewIDObject(id, 1)); err != ErrEmptyID {
+			t.Fatalf("Expected %q; got %v", ErrEmptyID, err)
+		}
+	}
+	if _, err := diff.AddBatch(context.Background(), []Object{NewIDObject([]byte("a"), 1), NewIDObject(nil, 2)}); err != ErrEmptyID {
+		t.Fatalf("Expected %q; got %v", ErrEmptyID, err)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected no pending changes; got %d", pending)
+	}
+}
+
+func TestDifferential_Add_ErrorContext(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	_, err := diff.Add(NewIDObject([]byte("a"), func() {}))
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if expect := "diffdb: Add: hash object for id 61"; !strings.HasPrefix(err.Error(), expect) {
+		t.Fatalf("Expected error starting with %q; got %q", expect, err)
+	}
+}
+
+func TestDifferential_Each_MissingHashData(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the differential by removing the payload of the pending change
+	err := diff.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diff.q)
+		return b.Bucket(bucketPendingHashData).Delete(b.Bucket(bucketPendingHashes).Get([]byte("a")))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil })
+	if !errors.Is(err, ErrMissingHashData) {
+		t.Fatalf("Expected %q; got %v", ErrMissingHashData, err)
+	}
+	if _, err := diff.Pending([]byte("a"), new(IDObject)); !errors.Is(err, ErrMissingHashData) {
+		t.Fatalf("Expected %q; got %v", ErrMissingHashData, err)
+	}
+}
+
+func TestDifferential_UserDataTx(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_user_data_tx")
+	defer done()
+
+	for i := 0; i < 3; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := diff.UpdateUserDataTx(func(tx *bolt.Tx, b *bolt.Bucket) error {
+		downstream, err := tx.CreateBucketIfNotExists([]byte("downstream"))
+		if err != nil {
+			return err
+		}
+		if err := downstream.Put([]byte("pending"), []byte(strconv.Itoa(diff.CountChangesTx(tx)))); err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = diff.ViewUserDataTx(func(tx *bolt.Tx, b *bolt.Bucket) error {
+		if value := b.Get([]byte("key")); string(value) != "value" {
+			t.Errorf("Expected user data value; got %q", value)
+		}
+		if pending := tx.Bucket([]byte("downstream")).Get([]byte("pending")); string(pending) != "3" {
+			t.Errorf("Expected 3 pending changes to be recorded; got %q", pending)
+		}
+		if tracking := diff.CountTrackingTx(tx); tracking != 0 {
+			t.Errorf("Expected nothing to be tracked; got %d", tracking)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,29 @@
+// Package diffdb tracks changes to Go objects by hashing their contents and comparing them to a previous version,
+// persisting state history to disk using BoltDB.
+//
+// Isolation
+//
+// Each operation runs in a single BoltDB transaction. BoltDB allows a single writer and many concurrent readers,
+// and every read transaction sees a consistent snapshot of the database as of the time it started.
+//
+// Changes staged by Add and applied by Each only become visible to other readers once the operation commits.
+// Reporting methods such as CountTracking, CountChanges and Changed, as well as PendingIterator,
+// called while Each is running (including from within an ApplyFunc) observe the state from before Each started.
+// Once Each returns, new reads observe all of the changes it applied, including those applied before
+// a context was cancelled.
+//
+// A read transaction held open for a long time, such as an unclosed PendingIter, can block a writer
+// if the database file needs to grow and be remapped. Use WithReserve to size the memory map up front
+// when reads are held open across writes.
+//
+// Operations may be called concurrently from multiple goroutines, but write operations such as Add and Each
+// are serialised by the single BoltDB writer, so one operation waits for another to commit.
+// EachPrefix applies changes in rounds and takes turns with concurrent EachPrefix calls,
+// allowing changes of disjoint namespaces to be applied in parallel without one call starving the others.
+//
+// Errors
+//
+// Failures that callers may need to handle are reported with sentinel errors such as ErrNoDifferential,
+// ErrConflictingKey, ErrTypeMismatch, ErrObjectTooLarge, ErrEmptyID and ErrMissingHashData.
+// These may be wrapped with additional context, so they should be tested with errors.Is rather than compared directly.
+package diffdb
@@ -0,0 +1,161 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/go-multierror"
+	"time"
+)
+
+// A Change is a pending change sent by DrainTo.
+// The consumer must call Ack exactly once after applying the change.
+type Change struct {
+	// ID is the ID of the change.
+	ID []byte
+	// Hash is the hash of the change.
+	Hash []byte
+	// Data decodes the payload of the change.
+	// Unlike the Decoder given to an ApplyFunc, it remains valid after the change is acknowledged.
+	Data Decoder
+
+	ack chan error
+}
+
+// Ack acknowledges that the change has been applied.
+// If err is not nil then the change is marked as failed and left pending, and err is reported by DrainTo.
+// Passing ErrSkip leaves the change pending without reporting an error.
+func (c Change) Ack(err error) {
+	c.ack <- err
+}
+
+// DrainTo sends each pending change to ch in ID order, waiting for each change to be acknowledged before sending the next.
+// Each acknowledged change is committed in its own transaction, so changes are not applied twice if DrainTo is interrupted,
+// and no lock is held on the database while the consumer applies a change.
+// Each committed change is recorded as a separate run by ChangeRate.
+//
+// Changes are checked by the validator set with WithValidator and the hook set with OnBeforeApply before they are sent,
+// and changes they reject are marked as failed without being sent.
+//
+// DrainTo returns once every pending change has been sent and acknowledged or the context is cancelled.
+// If a change is staged again while it is waiting to be acknowledged then the new change is left pending.
+// Errors acknowledged by the consumer or returned by the validator are accumulated and returned once every change has been sent.
+func (diff *Differential) DrainTo(ctx context.Context, ch chan<- Change) error {
+	if err := diff.ops.begin(); err != nil {
+		return err
+	}
+	defer diff.ops.end()
+
+	var (
+		after   []byte
+		results *multierror.Error
+	)
+
+	for {
+		var (
+			change   *Change
+			rejected error
+		)
+		err := diff.update(func(tx *bolt.Tx) error {
+			change, rejected = nil, nil
+			b := tx.Bucket(diff.q)
+			c := b.Bucket(bucketPendingHashes).Cursor()
+
+			id, hash := c.First()
+			if after != nil {
+				id, hash = c.Seek(after)
+				if bytes.Equal(id, after) {
+					id, hash = c.Next()
+				}
+			}
+			if id == nil {
+				return nil
+			}
+
+			data := payloadsOf(b).Get(hash)
+			if data == nil {
+				return ErrMissingHashData
+			}
+			change = &Change{
+				ID:   append([]byte(nil), id...),
+				Hash: append([]byte(nil), hash...),
+				Data: &msgpackDecoder{data: append([]byte(nil), data...)},
+				ack:  make(chan error, 1),
+			}
+
+			// Changes that fail validation or are vetoed are never sent and follow the same path as a failed change
+			rejected = diff.vet(change.ID, &msgpackDecoder{data: data}, tx)
+			if rejected == nil || errors.Is(rejected, ErrSkip) {
+				return nil
+			}
+			return diff.markFailed(b, change.ID, rejected)
+		})
+		if err != nil {
+			return err
+		}
+		if change == nil {
+			return results.ErrorOrNil()
+		}
+		after = change.ID
+
+		if rejected != nil {
+			if !errors.Is(rejected, ErrSkip) {
+				results = multierror.Append(results, rejected)
+			}
+			continue
+		}
+
+		select {
+		case ch <- *change:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		var ackErr error
+		select {
+		case ackErr = <-change.ack:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// The change has been applied so it is committed even if the context has since been cancelled
+		var failed error
+		err = diff.update(func(tx *bolt.Tx) error {
+			failed = nil
+			start := time.Now()
+			b := tx.Bucket(diff.q)
+
+			// A change staged again while it was being applied is left pending
+			if !bytes.Equal(b.Bucket(bucketPendingHashes).Get(change.ID), change.Hash) || errors.Is(ackErr, ErrSkip) {
+				return diff.finishEach(tx, start, 0, nil)
+			}
+			if ackErr != nil {
+				failed = ackErr
+				if err := diff.markFailed(b, change.ID, ackErr); err != nil {
+					return err
+				}
+				return diff.finishEach(tx, start, 0, nil)
+			}
+
+			bphd := payloadsOf(b)
+			data := bphd.Get(change.Hash)
+			if data == nil {
+				return ErrMissingHashData
+			}
+			if err := diff.commitChange(b, bphd, change.ID, change.Hash, data); err != nil {
+				return err
+			}
+			if err := diff.applied(change.ID, tx); err != nil {
+				return err
+			}
+			return diff.finishEach(tx, start, 1, change.ID)
+		})
+		if err != nil {
+			return err
+		}
+		if failed != nil {
+			results = multierror.Append(results, failed)
+		}
+	}
+}
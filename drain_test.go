@@ -0,0 +1,113 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDifferential_DrainTo(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	for _, obj := range []Object{NewIDObject([]byte("a"), 1), NewIDObject([]byte("b"), 2), NewIDObject([]byte("c"), 3)} {
+		if _, err := diff.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failure := errors.New("failed")
+	ch := make(chan Change)
+	consumed := make(chan []string)
+	go func() {
+		var ids []string
+		for c := range ch {
+			var obj struct {
+				Object int
+			}
+			if err := c.Data.Decode(&obj); err != nil {
+				t.Error(err)
+			}
+			ids = append(ids, string(c.ID))
+			if string(c.ID) == "b" {
+				c.Ack(failure)
+				continue
+			}
+			c.Ack(nil)
+		}
+		consumed <- ids
+	}()
+
+	err := diff.DrainTo(context.Background(), ch)
+	close(ch)
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected %q; got %v", failure, err)
+	}
+
+	if ids := <-consumed; len(ids) != 3 {
+		t.Fatalf("Expected 3 changes to be sent; got %q", ids)
+	}
+	pending, err := diff.PendingIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || string(pending[0]) != "b" {
+		t.Fatalf("Expected only b to remain pending; got %q", pending)
+	}
+	if tracking := diff.CountTracking(); tracking != 2 {
+		t.Fatalf("Expected 2 tracked IDs; got %d", tracking)
+	}
+}
+
+func TestDifferential_DrainTo_Validator(t *testing.T) {
+	invalid := errors.New("invalid")
+	diff, done := openTestDifferential(t, "test", WithValidator(func(id []byte, d Decoder) error {
+		if string(id) == "b" {
+			return invalid
+		}
+		return nil
+	}))
+	defer done()
+
+	for _, obj := range []Object{NewIDObject([]byte("a"), 1), NewIDObject([]byte("b"), 2), NewIDObject([]byte("c"), 3)} {
+		if _, err := diff.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	drain := func() ([]string, error) {
+		ch := make(chan Change)
+		consumed := make(chan []string)
+		go func() {
+			var ids []string
+			for c := range ch {
+				ids = append(ids, string(c.ID))
+				c.Ack(nil)
+			}
+			consumed <- ids
+		}()
+		err := diff.DrainTo(context.Background(), ch)
+		close(ch)
+		return <-consumed, err
+	}
+
+	ids, err := drain()
+	if !errors.Is(err, invalid) {
+		t.Fatalf("Expected %q; got %v", invalid, err)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "c" {
+		t.Fatalf("Expected the invalid change not to be sent; got %q", ids)
+	}
+	failed, err := diff.Failed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || string(failed[0]) != "b" {
+		t.Fatalf("Expected b to be marked as failed; got %q", failed)
+	}
+
+	// The rejected change is not sent on a retry either
+	if ids, err = drain(); !errors.Is(err, invalid) || len(ids) != 0 {
+		t.Fatalf("Expected no changes to be sent on retry; got %q and %v", ids, err)
+	}
+}
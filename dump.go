@@ -0,0 +1,51 @@
+package diffdb
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	"io"
+)
+
+// Dump writes a human-readable listing of the differential's state to w for debugging.
+// Each committed ID is written along with its committed hash,
+// followed by each pending change with its pending hash and payload as decoded by decode.
+// If decode is nil then pending payloads are omitted.
+// Hashes are written in hexadecimal.
+func (diff *Differential) Dump(w io.Writer, decode func(Decoder) (interface{}, error)) error {
+	return diff.db.View(func(tx *bolt.Tx) error {
+		var (
+			b    = tx.Bucket(diff.q)
+			bh   = b.Bucket(bucketHashes)
+			bph  = b.Bucket(bucketPendingHashes)
+			bphd = payloadsOf(b)
+		)
+
+		if _, err := fmt.Fprintf(w, "differential %q: %d committed, %d pending\n", diff.Name(), bh.Stats().KeyN, bph.Stats().KeyN); err != nil {
+			return err
+		}
+
+		err := bh.ForEach(func(id, hash []byte) error {
+			_, err := fmt.Fprintf(w, "committed\t%q\t%x\n", id, hash)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		decoder := new(msgpackDecoder)
+		return bph.ForEach(func(id, hash []byte) error {
+			if decode == nil {
+				_, err := fmt.Fprintf(w, "pending\t%q\t%x\n", id, hash)
+				return err
+			}
+
+			decoder.data = bphd.Get(hash)
+			v, err := decode(decoder)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "pending\t%q\t%x\t%+v\n", id, hash, v)
+			return err
+		})
+	})
+}
@@ -0,0 +1,44 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDifferential_Dump(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_dump")
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), "committed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("b"), "pending")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err := diff.Dump(&buf, func(data Decoder) (interface{}, error) {
+		var v IDObject
+		err := data.Decode(&v)
+		return v.Object, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines; got %q", lines)
+	}
+	if !strings.HasPrefix(lines[1], "committed\t\"a\"\t") {
+		t.Fatalf("Unexpected committed line %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "pending\t\"b\"\t") || !strings.HasSuffix(lines[2], "\tpending") {
+		t.Fatalf("Unexpected pending line %q", lines[2])
+	}
+}
@@ -0,0 +1,166 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/go-multierror"
+	"time"
+)
+
+// EachFailed scans through each change that failed to apply in a previous call to Each
+// and attempts to apply f() to it.
+// Changes that succeed have their failed marker cleared, those that fail again remain marked as failed.
+// This can be used to retry only the failed subset of changes rather than rescanning all pending changes.
+func (diff *Differential) EachFailed(ctx context.Context, f ApplyFunc) error {
+	return diff.each(ctx, f.apply, -1, openFailedCursor)
+}
+
+// ChangeMeta describes a pending change given to the function passed to EachMeta.
+type ChangeMeta struct {
+	// Hash is the hash of the pending change.
+	Hash []byte
+	// Previous is the committed hash the change replaces, or nil if there is none.
+	Previous []byte
+	// Created is true if the ID has no committed hash.
+	Created bool
+}
+
+// ApplyMetaFunc is a function to be called to apply each pending change given to EachMeta.
+// The slices in meta are only valid for the duration of the call.
+type ApplyMetaFunc func(id []byte, meta ChangeMeta, data Decoder) error
+
+func (f ApplyMetaFunc) apply(id []byte, meta ChangeMeta, data Decoder, _ *bolt.Tx) error {
+	return f(id, meta, data)
+}
+
+// EachMeta is like Each but also gives f metadata about each change,
+// such as whether it creates or updates an ID and the hash it replaces.
+func (diff *Differential) EachMeta(ctx context.Context, f ApplyMetaFunc) error {
+	return diff.each(ctx, f.apply, -1, openPendingCursor)
+}
+
+// EachReverse is like Each but applies pending changes in descending ID order.
+// Combined with a partial drain through EachN or cancelling the context,
+// this allows the changes with the greatest IDs to be prioritised.
+func (diff *Differential) EachReverse(ctx context.Context, f ApplyFunc) error {
+	return diff.each(ctx, f.apply, -1, openReversePendingCursor)
+}
+
+// EachWithin is like Each but stops applying pending changes once d has elapsed,
+// committing the changes applied so far in the same way as when ctx is cancelled.
+// Reaching the deadline is not reported as an error, so this can be used to apply changes
+// within a bounded maintenance window and continue with the remaining changes on the next call.
+// The deadline is checked between changes and does not interrupt a call to f already in progress.
+// Cancellation of ctx itself is still reported as an error.
+func (diff *Differential) EachWithin(ctx context.Context, d time.Duration, f ApplyFunc) error {
+	budget, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	err := diff.each(budget, f.apply, -1, openPendingCursor)
+	if ctx.Err() != nil {
+		return err
+	}
+
+	merr, ok := err.(*multierror.Error)
+	if !ok {
+		return err
+	}
+	var remaining *multierror.Error
+	for _, err := range merr.Errors {
+		if err != context.DeadlineExceeded {
+			remaining = multierror.Append(remaining, err)
+		}
+	}
+	return remaining.ErrorOrNil()
+}
+
+// openReversePendingCursor opens a cursor over all pending changes in descending ID order.
+func openReversePendingCursor(b *bolt.Bucket) (changeCursor, error) {
+	return reverseCursor{b.Bucket(bucketPendingHashes).Cursor()}, nil
+}
+
+// reverseCursor is a changeCursor that iterates a BoltDB cursor from last to first
+type reverseCursor struct {
+	c *bolt.Cursor
+}
+
+func (c reverseCursor) First() ([]byte, []byte) {
+	return c.c.Last()
+}
+
+func (c reverseCursor) Next() ([]byte, []byte) {
+	return c.c.Prev()
+}
+
+// Failed returns the IDs of pending changes that failed to apply in a previous call to Each.
+func (diff *Differential) Failed() (ids [][]byte, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diff.q)
+		bph := b.Bucket(bucketPendingHashes)
+		return b.Bucket(bucketFailed).ForEach(func(id, _ []byte) error {
+			if bph.Get(id) != nil {
+				ids = append(ids, append([]byte(nil), id...))
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// openFailedCursor collects each failed change that is still pending.
+// Failed markers for changes that are no longer pending are removed.
+func openFailedCursor(b *bolt.Bucket) (changeCursor, error) {
+	var (
+		bph = b.Bucket(bucketPendingHashes)
+		bfl = b.Bucket(bucketFailed)
+
+		cur   = new(sliceCursor)
+		stale [][]byte
+	)
+
+	err := bfl.ForEach(func(id, _ []byte) error {
+		if hash := bph.Get(id); hash != nil {
+			cur.ids = append(cur.ids, id)
+			cur.hashes = append(cur.hashes, hash)
+		} else {
+			stale = append(stale, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range stale {
+		if err := bfl.Delete(id); err != nil {
+			return nil, err
+		}
+	}
+
+	return cur, nil
+}
+
+var _ changeCursor = (*sliceCursor)(nil)
+
+// sliceCursor is a changeCursor over a fixed set of changes
+type sliceCursor struct {
+	ids, hashes [][]byte
+	i           int
+}
+
+func (c *sliceCursor) First() ([]byte, []byte) {
+	c.i = 0
+	return c.at()
+}
+
+func (c *sliceCursor) Next() ([]byte, []byte) {
+	c.i++
+	return c.at()
+}
+
+func (c *sliceCursor) at() ([]byte, []byte) {
+	if c.i >= len(c.ids) {
+		return nil, nil
+	}
+	return c.ids[c.i], c.hashes[c.i]
+}
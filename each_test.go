@@ -0,0 +1,330 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestDB opens a new temporary database.
+// The returned function closes and removes the database.
+func openTestDB(t *testing.T, opts ...Option) (*DB, func()) {
+	dir, err := ioutil.TempDir(os.TempDir(), "_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(filepath.Join(dir, "state.db"), opts...)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// openTestDifferential opens a differential in a new temporary database.
+// The returned function closes and removes the database.
+func openTestDifferential(t *testing.T, name string, opts ...Option) (*Differential, func()) {
+	db, done := openTestDB(t, opts...)
+
+	diff, err := db.Open(name)
+	if err != nil {
+		done()
+		t.Fatal(err)
+	}
+
+	return diff, done
+}
+
+func TestDifferential_EachFailed(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_failed")
+	defer done()
+
+	for i := 0; i < 5; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var errOdd = errors.New("odd")
+	err := diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		x, err := strconv.Atoi(string(id))
+		if err != nil {
+			return err
+		}
+		if x%2 == 1 {
+			return errOdd
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Expected an error from Each")
+	}
+
+	failed, err := diff.Failed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 2 || string(failed[0]) != "1" || string(failed[1]) != "3" {
+		t.Fatalf("Expected failed IDs [1 3]; got %q", failed)
+	}
+
+	var retried []string
+	err = diff.EachFailed(context.Background(), func(id []byte, data Decoder) error {
+		retried = append(retried, string(id))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retried) != 2 {
+		t.Fatalf("Expected 2 retried changes; got %q", retried)
+	}
+
+	failed, err = diff.Failed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 0 {
+		t.Fatalf("Expected no failed changes; got %q", failed)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected 0 pending changes; got %d", pending)
+	}
+}
+
+// Test that an error removing a stale failed marker is returned rather than ignored.
+func TestOpenFailedCursor_Error(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_open_failed_cursor")
+	defer done()
+
+	err := diff.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diff.q).Bucket(bucketFailed).Put([]byte("stale"), []byte("failed"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		_, err := openFailedCursor(tx.Bucket(diff.q))
+		return err
+	})
+	if err != bolt.ErrTxNotWritable {
+		t.Fatalf("Expected %q; got %v", bolt.ErrTxNotWritable, err)
+	}
+}
+
+func TestDifferential_EachTx(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_tx")
+	defer done()
+
+	for i := 0; i < 3; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A rolled back transaction must not advance any hashes
+	tx, err := diff.db.Begin(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = diff.EachTx(context.Background(), tx, func(id []byte, data Decoder, tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("downstream"))
+		if err != nil {
+			return err
+		}
+		return b.Put(id, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if pending := diff.CountChanges(); pending != 3 {
+		t.Fatalf("Expected 3 pending changes after rollback; got %d", pending)
+	}
+
+	err = diff.db.Update(func(tx *bolt.Tx) error {
+		return diff.EachTx(context.Background(), tx, func(id []byte, data Decoder, tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte("downstream"))
+			if err != nil {
+				return err
+			}
+			return b.Put(id, nil)
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected 0 pending changes; got %d", pending)
+	}
+}
+
+func TestDifferential_Each_Skip(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_skip")
+	defer done()
+
+	for i := 0; i < 4; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		if string(id) < "2" {
+			return ErrSkip
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected skipped changes not to be reported as errors; got %v", err)
+	}
+
+	if pending := diff.CountChanges(); pending != 2 {
+		t.Fatalf("Expected 2 pending changes; got %d", pending)
+	}
+	failed, err := diff.Failed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 0 {
+		t.Fatalf("Expected skipped changes not to be marked as failed; got %q", failed)
+	}
+}
+
+func TestDifferential_Each_SkipWrapped(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_skip_wrapped")
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	err := diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		return fmt.Errorf("not ready: %w", ErrSkip)
+	})
+	if err != nil {
+		t.Fatalf("Expected a wrapped ErrSkip not to be reported as an error; got %v", err)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+	if failed, err := diff.Failed(); err != nil || len(failed) != 0 {
+		t.Fatalf("Expected the skipped change not to be marked as failed; got %q, %v", failed, err)
+	}
+}
+
+func TestDifferential_EachMeta(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_meta")
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	var committed []byte
+	err := diff.EachMeta(context.Background(), func(id []byte, meta ChangeMeta, data Decoder) error {
+		if !meta.Created || meta.Previous != nil {
+			t.Errorf("Expected a created change; got %+v", meta)
+		}
+		committed = append([]byte(nil), meta.Hash...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), 2)); err != nil {
+		t.Fatal(err)
+	}
+	err = diff.EachMeta(context.Background(), func(id []byte, meta ChangeMeta, data Decoder) error {
+		if meta.Created || string(meta.Previous) != string(committed) {
+			t.Errorf("Expected an update of %x; got %+v", committed, meta)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDifferential_EachReverse(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_reverse")
+	defer done()
+
+	for i := 0; i < 5; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids []string
+	err := diff.EachReverse(context.Background(), func(id []byte, data Decoder) error {
+		ids = append(ids, string(id))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []string{"4", "3", "2", "1", "0"}; strings.Join(ids, ",") != strings.Join(expect, ",") {
+		t.Fatalf("Expected IDs in order %v; got %v", expect, ids)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected no pending changes; got %d", pending)
+	}
+	if tracking := diff.CountTracking(); tracking != 5 {
+		t.Fatalf("Expected 5 tracked IDs; got %d", tracking)
+	}
+}
+
+func TestDifferential_EachWithin(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_within")
+	defer done()
+
+	for i := 0; i < 5; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var applied int
+	err := diff.EachWithin(context.Background(), 20*time.Millisecond, func(id []byte, data Decoder) error {
+		applied++
+		if applied == 2 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected reaching the deadline not to be an error; got %v", err)
+	}
+	if applied != 2 {
+		t.Fatalf("Expected 2 applied changes; got %d", applied)
+	}
+	if pending := diff.CountChanges(); pending != 3 {
+		t.Fatalf("Expected 3 pending changes; got %d", pending)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = diff.EachWithin(ctx, time.Minute, func(id []byte, data Decoder) error {
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected %q; got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,55 @@
+package diffdb
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/vmihailenco/msgpack.v2"
+	"reflect"
+)
+
+// ErrUnencodable indicates that an object contains a value that cannot be encoded by the msgpack codec.
+// The returned error wraps ErrUnencodable with the path and type of the offending field.
+// Fields that are not needed in the payload can be excluded with a `msgpack:"-"` tag,
+// and also with a `hash:"ignore"` tag if they should not be hashed either.
+var ErrUnencodable = errors.New("diffdb: object cannot be encoded")
+
+var customEncoderType = reflect.TypeOf((*msgpack.CustomEncoder)(nil)).Elem()
+
+// unencodable returns true if values of kind k cannot be encoded with msgpack.
+func unencodable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Uintptr, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
+
+// encodedFields returns the indexes of the fields of struct type t that are encoded by msgpack:
+// exported and embedded fields that are not excluded with a `msgpack:"-"` tag.
+// Types that encode themselves have no encoded fields.
+func encodedFields(t reflect.Type) []int {
+	if t.Implements(customEncoderType) || reflect.PtrTo(t).Implements(customEncoderType) {
+		return nil
+	}
+
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		if f.Tag.Get("msgpack") == "-" {
+			continue
+		}
+		fields = append(fields, i)
+	}
+	return fields
+}
+
+// describeUnencodable wraps ErrUnencodable with the path and type of the first value in x that cannot be encoded.
+// If no such value is found then err is returned unchanged.
+func describeUnencodable(x interface{}, err error) error {
+	if path, t, ok := findUnsupported(reflect.ValueOf(x), "object", unencodable, encodedFields); ok {
+		return errors.Wrapf(ErrUnencodable, "diffdb: %s has type %s", path, t)
+	}
+	return err
+}
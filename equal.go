@@ -0,0 +1,41 @@
+package diffdb
+
+import (
+	"github.com/boltdb/bolt"
+	"reflect"
+)
+
+// WithEqualFunc registers a function used as a secondary check for changes when the hash of an object given to Add
+// differs from its committed hash. If equal returns true then the object is treated as unchanged and nothing is staged,
+// which allows objects that are semantically equivalent but encode differently, such as floats within an epsilon,
+// to avoid spurious changes.
+//
+// equal is called with the added object and its committed version, decoded into a new value of the same type.
+// The committed version is only available for objects applied with WithRetainCommitted;
+// objects without a retained payload are compared by hash alone.
+// Equality is not checked when WithoutDedup is used.
+func WithEqualFunc(equal func(a, b interface{}) (bool, error)) Option {
+	return func(db *DB) {
+		db.equal = equal
+	}
+}
+
+// equalCommitted reports whether x is equal to the committed version of id in b according to the differential's equal function.
+// It is false if there is no retained committed payload for id.
+func (diff *Differential) equalCommitted(b *bolt.Bucket, id []byte, x interface{}) (bool, error) {
+	bcd := b.Bucket(bucketCommittedData)
+	if bcd == nil {
+		return false, nil
+	}
+	data := bcd.Get(id)
+	if data == nil {
+		return false, nil
+	}
+
+	committed := reflect.New(reflect.TypeOf(x))
+	d := msgpackDecoder{data: data}
+	if err := d.Decode(committed.Interface()); err != nil {
+		return false, err
+	}
+	return diff.equal(x, committed.Elem().Interface())
+}
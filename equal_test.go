@@ -0,0 +1,46 @@
+package diffdb
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+type measurement struct {
+	Key   string
+	Value float64
+}
+
+func (m measurement) ID() []byte {
+	return []byte(m.Key)
+}
+
+func TestWithEqualFunc(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_equal", WithRetainCommitted(), WithEqualFunc(func(a, b interface{}) (bool, error) {
+		return math.Abs(a.(measurement).Value-b.(measurement).Value) < 0.01, nil
+	}))
+	defer done()
+
+	if _, err := diff.Add(measurement{Key: "a", Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := diff.Add(measurement{Key: "a", Value: 1.001})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated {
+		t.Fatal("Expected an equivalent object not to be staged")
+	}
+
+	updated, err = diff.Add(measurement{Key: "a", Value: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Fatal("Expected a different object to be staged")
+	}
+}
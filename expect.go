@@ -0,0 +1,62 @@
+package diffdb
+
+import (
+	"bytes"
+	"errors"
+	"github.com/boltdb/bolt"
+)
+
+// ErrStaleObject indicates that the latest hash of an object given to AddExpecting
+// did not match the expected hash.
+var ErrStaleObject = errors.New("diffdb: latest hash does not match the expected hash")
+
+// AddExpecting adds x under id to the list of pending changes only if the latest hash of id is expectedHash,
+// otherwise ErrStaleObject is returned and nothing is staged.
+// The latest hash is the hash of the pending change of id if there is one, otherwise its committed hash,
+// so that a producer cannot overwrite a change staged by another producer that has not been applied yet.
+// A nil expectedHash expects id to have neither a pending change nor a committed hash.
+// This provides compare-and-swap semantics to guard against lost updates when multiple producers stage the same ID.
+// The expected hash would typically come from a previous call to PendingHash or CommittedHash.
+func (diff *Differential) AddExpecting(id []byte, x interface{}, expectedHash []byte) error {
+	if err := diff.ops.begin(); err != nil {
+		return err
+	}
+	defer diff.ops.end()
+
+	return diff.update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(diff.q).Bucket(bucketPendingHashes).Get(id)
+		_, _, err := diff.stage(tx, id, x, nil, func(committed []byte) error {
+			latest := committed
+			if pending != nil {
+				latest = pending
+			}
+			if bytes.Compare(latest, expectedHash) != 0 {
+				return ErrStaleObject
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+// PendingHash returns the hash of the pending change of id, or nil if id has no pending change.
+func (diff *Differential) PendingHash(id []byte) (hash []byte, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		if h := tx.Bucket(diff.q).Bucket(bucketPendingHashes).Get(id); h != nil {
+			hash = append([]byte(nil), h...)
+		}
+		return nil
+	})
+	return
+}
+
+// CommittedHash returns the committed hash of id, or nil if id has no committed hash.
+func (diff *Differential) CommittedHash(id []byte) (hash []byte, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		if h := tx.Bucket(diff.q).Bucket(bucketHashes).Get(id); h != nil {
+			hash = append([]byte(nil), h...)
+		}
+		return nil
+	})
+	return
+}
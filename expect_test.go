@@ -0,0 +1,97 @@
+package diffdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDifferential_AddExpecting(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_expecting")
+	defer done()
+
+	var id = []byte("a")
+	if err := diff.AddExpecting(id, "v1", []byte("not committed")); err != ErrStaleObject {
+		t.Fatalf("Expected %q; got %v", ErrStaleObject, err)
+	}
+	if err := diff.AddExpecting(id, "v1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := diff.CommittedHash(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == nil {
+		t.Fatal("Expected a committed hash")
+	}
+
+	if err := diff.AddExpecting(id, "v2", nil); err != ErrStaleObject {
+		t.Fatalf("Expected %q; got %v", ErrStaleObject, err)
+	}
+	if err := diff.AddExpecting(id, "v2", hash); err != nil {
+		t.Fatal(err)
+	}
+
+	var v string
+	err = diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		return data.Decode(&v)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "v2" {
+		t.Fatalf("Expected payload %q; got %q", "v2", v)
+	}
+}
+
+func TestDifferential_AddExpecting_Pending(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_expecting_pending")
+	defer done()
+
+	var id = []byte("a")
+	if _, err := diff.Add(NewIDObject(id, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	committed, err := diff.CommittedHash(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another producer stages a change over the committed version
+	if err := diff.AddExpecting(id, "v2", committed); err != nil {
+		t.Fatal(err)
+	}
+
+	// The committed hash is no longer the latest, so staging over it would lose the pending change
+	if err := diff.AddExpecting(id, "v3", committed); err != ErrStaleObject {
+		t.Fatalf("Expected %q; got %v", ErrStaleObject, err)
+	}
+
+	pending, err := diff.PendingHash(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending == nil {
+		t.Fatal("Expected a pending hash")
+	}
+	if err := diff.AddExpecting(id, "v3", pending); err != nil {
+		t.Fatal(err)
+	}
+
+	var v string
+	err = diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		return data.Decode(&v)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "v3" {
+		t.Fatalf("Expected payload %q; got %q", "v3", v)
+	}
+}
@@ -0,0 +1,105 @@
+package diffdb
+
+import (
+	"encoding/json"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// ErrNotRetained indicates that the committed payload of an object is not available
+// because it was not applied with WithRetainCommitted.
+var ErrNotRetained = errors.New("diffdb: committed payload is not retained")
+
+// exportedChange is a single line written by ExportChanges.
+// ID is a byte slice so that IDs which are not valid UTF-8 survive the round trip as base64.
+type exportedChange struct {
+	ID      []byte      `json:"id"`
+	Data    interface{} `json:"data"`
+	Deleted bool        `json:"deleted,omitempty"`
+}
+
+// ExportChanges writes each pending change to w as a line of JSON in the form {"id": ..., "data": ...},
+// where id is the base64 encoding of the change's ID, as encoding/json encodes a []byte,
+// and data is the value returned by encode for the change's payload.
+// The changes are read in a single read transaction and remain pending afterwards,
+// so exporting does not advance the state of the differential.
+func (diff *Differential) ExportChanges(w io.Writer, encode func(Decoder) (interface{}, error)) error {
+	return diff.db.View(func(tx *bolt.Tx) error {
+		var (
+			b    = tx.Bucket(diff.q)
+			bphd = payloadsOf(b)
+
+			enc     = json.NewEncoder(w)
+			decoder = new(msgpackDecoder)
+		)
+
+		return b.Bucket(bucketPendingHashes).ForEach(func(id, hash []byte) error {
+			decoder.data = bphd.Get(hash)
+			data, err := encode(decoder)
+			if err != nil {
+				return err
+			}
+			return enc.Encode(exportedChange{
+				ID:   id,
+				Data: data,
+			})
+		})
+	})
+}
+
+// ChangesSince reads a manifest written by Manifest, typically from a remote copy of the differential,
+// and writes the committed payload of each ID whose committed hash differs from the manifest to w,
+// so that a replica can be brought up to date by transferring only what has changed.
+// Payloads are written in ID order in the same form as ExportChanges;
+// IDs in the manifest that are not committed locally or have been deleted with Remove are written
+// as {"id": ..., "data": null, "deleted": true}.
+//
+// The committed payloads are only available when the differential is opened with WithRetainCommitted,
+// otherwise ErrNotRetained is returned. An error wrapping ErrNotRetained is also returned
+// for a differing ID that was applied before WithRetainCommitted was used.
+func (diff *Differential) ChangesSince(remoteManifest io.Reader, w io.Writer, encode func(Decoder) (interface{}, error)) error {
+	if !diff.retain {
+		return ErrNotRetained
+	}
+
+	return diff.db.View(func(tx *bolt.Tx) error {
+		diffIDs, err := diff.compareManifestTx(tx, remoteManifest)
+		if err != nil {
+			return err
+		}
+
+		var (
+			b   = tx.Bucket(diff.q)
+			bh  = b.Bucket(bucketHashes)
+			bcd = b.Bucket(bucketCommittedData)
+
+			enc     = json.NewEncoder(w)
+			decoder = new(msgpackDecoder)
+		)
+
+		for _, id := range diffIDs {
+			if hash := bh.Get(id); hash == nil || isTombstone(hash) {
+				if err := enc.Encode(exportedChange{ID: id, Deleted: true}); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if bcd != nil {
+				decoder.data = bcd.Get(id)
+			}
+			if bcd == nil || decoder.data == nil {
+				return errors.Wrapf(ErrNotRetained, "diffdb: ChangesSince: id %x", id)
+			}
+			data, err := encode(decoder)
+			if err != nil {
+				return err
+			}
+			if err := enc.Encode(exportedChange{ID: id, Data: data}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,130 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestDifferential_ExportChanges(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_export")
+	defer done()
+
+	if _, err := diff.Add(emailObject{Id: "1", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(emailObject{Id: "2", Email: "b@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err := diff.ExportChanges(&buf, func(data Decoder) (interface{}, error) {
+		var o emailObject
+		err := data.Decode(&o)
+		return o, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const expect = `{"id":"MQ==","data":{"Id":"1","Email":"a@example.com"}}
+{"id":"Mg==","data":{"Id":"2","Email":"b@example.com"}}
+`
+	if buf.String() != expect {
+		t.Fatalf("Unexpected export %q", buf.String())
+	}
+	if pending := diff.CountChanges(); pending != 2 {
+		t.Fatalf("Expected export not to consume changes; got %d pending", pending)
+	}
+}
+
+func TestDifferential_ExportChanges_BinaryID(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_export_binary")
+	defer done()
+
+	id := []byte{0xff, 0x00, 0xfe}
+	if _, err := diff.Add(NewIDObject(id, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err := diff.ExportChanges(&buf, func(data Decoder) (interface{}, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var line exportedChange
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(line.ID, id) {
+		t.Fatalf("Expected the exported ID to round trip as %x; got %x", id, line.ID)
+	}
+}
+
+func TestDifferential_ChangesSince(t *testing.T) {
+	db, done := openTestDB(t, WithRetainCommitted())
+	defer done()
+
+	commit := func(diff *Differential, objs ...Object) {
+		for _, obj := range objs {
+			if _, err := diff.Add(obj); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	local, err := db.Open("local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := db.Open("remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit(local,
+		emailObject{Id: "1", Email: "a@example.com"},
+		emailObject{Id: "2", Email: "b@example.com"},
+		emailObject{Id: "3", Email: "c@example.com"},
+	)
+	commit(remote,
+		emailObject{Id: "1", Email: "a@example.com"},
+		emailObject{Id: "2", Email: "old@example.com"},
+		emailObject{Id: "4", Email: "d@example.com"},
+	)
+
+	var manifest, buf bytes.Buffer
+	if err := remote.Manifest(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	err = local.ChangesSince(&manifest, &buf, func(data Decoder) (interface{}, error) {
+		var o emailObject
+		err := data.Decode(&o)
+		return o, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const expect = `{"id":"Mg==","data":{"Id":"2","Email":"b@example.com"}}
+{"id":"Mw==","data":{"Id":"3","Email":"c@example.com"}}
+{"id":"NA==","data":null,"deleted":true}
+`
+	if buf.String() != expect {
+		t.Fatalf("Unexpected changes %q", buf.String())
+	}
+}
+
+func TestDifferential_ChangesSince_NotRetained(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_changes_since")
+	defer done()
+
+	var buf bytes.Buffer
+	if err := diff.ChangesSince(&bytes.Buffer{}, &buf, nil); err != ErrNotRetained {
+		t.Fatalf("Expected %q; got %v", ErrNotRetained, err)
+	}
+}
@@ -0,0 +1,234 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"github.com/boltdb/bolt"
+)
+
+// ForgetPrefix stops tracking every ID that starts with prefix in a single transaction,
+// deleting its committed hash, any pending change and any failed marker.
+// It returns the number of distinct IDs removed. IDs pinned with Pin are skipped.
+// This is useful to decommission a whole namespace of IDs, such as those built with CompositeID for a deleted tenant.
+func (diff *Differential) ForgetPrefix(prefix []byte) (removed int, err error) {
+	return diff.ForgetPrefixContext(context.Background(), prefix)
+}
+
+// cancelCheckInterval is the number of entries processed between checks for cancellation in long running operations
+const cancelCheckInterval = 4096
+
+// ForgetPrefixContext is like ForgetPrefix but aborts and rolls back if the context is cancelled,
+// returning the context error. Cancellation is checked periodically so that removing a large namespace
+// does not hold the write lock after the caller has given up.
+func (diff *Differential) ForgetPrefixContext(ctx context.Context, prefix []byte) (removed int, err error) {
+	var i int
+	cancelled := func() error {
+		i++
+		if i%cancelCheckInterval != 0 {
+			return nil
+		}
+		return ctx.Err()
+	}
+
+	err = diff.updateOp(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var (
+			b    = tx.Bucket(diff.q)
+			bh   = b.Bucket(bucketHashes)
+			bph  = b.Bucket(bucketPendingHashes)
+			bphd = payloadsOf(b)
+			bfl  = b.Bucket(bucketFailed)
+		)
+
+		committed := unpinned(b, keysWithPrefix(bh, prefix))
+		var tombstones int
+		for _, id := range committed {
+			if isTombstone(bh.Get(id)) {
+				tombstones++
+			}
+		}
+		if err := adjustTombstones(b, -tombstones); err != nil {
+			return err
+		}
+		for _, id := range committed {
+			if err := cancelled(); err != nil {
+				return err
+			}
+			if err := bh.Delete(id); err != nil {
+				return err
+			}
+		}
+		removed = len(committed)
+
+		for _, id := range unpinned(b, keysWithPrefix(bph, prefix)) {
+			if err := cancelled(); err != nil {
+				return err
+			}
+			if !containsKey(committed, id) {
+				removed++
+			}
+			if err := bphd.Delete(bph.Get(id)); err != nil {
+				return err
+			}
+			if err := bph.Delete(id); err != nil {
+				return err
+			}
+		}
+
+		for _, id := range unpinned(b, keysWithPrefix(bfl, prefix)) {
+			if err := cancelled(); err != nil {
+				return err
+			}
+			if err := bfl.Delete(id); err != nil {
+				return err
+			}
+		}
+
+		if bsi := b.Bucket(bucketSequenceIDs); bsi != nil {
+			for _, id := range unpinned(b, keysWithPrefix(bsi, prefix)) {
+				if err := cancelled(); err != nil {
+					return err
+				}
+				if err := releaseSequence(b, id); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, name := range idBuckets {
+			bo := b.Bucket(name)
+			if bo == nil {
+				continue
+			}
+			for _, id := range unpinned(b, keysWithPrefix(bo, prefix)) {
+				if err := cancelled(); err != nil {
+					return err
+				}
+				if err := bo.Delete(id); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
+
+// ForgetBatch stops tracking each of ids in a single transaction,
+// deleting its committed hash, any pending or held change and any failed marker.
+// It returns the number of IDs that were tracked and have been removed;
+// IDs that are not tracked or are pinned with Pin are ignored.
+// This is useful to clean up a batch of deletions once they have been confirmed downstream,
+// without the cost of a transaction per ID.
+func (diff *Differential) ForgetBatch(ids [][]byte) (removed int, err error) {
+	return diff.ForgetBatchContext(context.Background(), ids)
+}
+
+// ForgetBatchContext is like ForgetBatch but aborts and rolls back if the context is cancelled,
+// returning the context error. Cancellation is checked periodically as in ForgetPrefixContext.
+func (diff *Differential) ForgetBatchContext(ctx context.Context, ids [][]byte) (removed int, err error) {
+	err = diff.updateOp(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var (
+			b    = tx.Bucket(diff.q)
+			bh   = b.Bucket(bucketHashes)
+			bph  = b.Bucket(bucketPendingHashes)
+			bphd = payloadsOf(b)
+			bfl  = b.Bucket(bucketFailed)
+		)
+
+		removed = 0
+		for i, id := range ids {
+			if i%cancelCheckInterval == cancelCheckInterval-1 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			if isPinned(b, id) {
+				continue
+			}
+
+			var found bool
+			if hash := bh.Get(id); hash != nil {
+				found = true
+				if isTombstone(hash) {
+					if err := adjustTombstones(b, -1); err != nil {
+						return err
+					}
+				}
+				if err := bh.Delete(id); err != nil {
+					return err
+				}
+			}
+			if hash := bph.Get(id); hash != nil {
+				found = true
+				if err := bphd.Delete(hash); err != nil {
+					return err
+				}
+				if err := bph.Delete(id); err != nil {
+					return err
+				}
+			}
+			if found {
+				removed++
+			}
+
+			// Untracked IDs may still have state, such as a change held while paused
+			if err := bfl.Delete(id); err != nil {
+				return err
+			}
+			if err := releaseSequence(b, id); err != nil {
+				return err
+			}
+			for _, name := range idBuckets {
+				if bo := b.Bucket(name); bo != nil {
+					if err := bo.Delete(id); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
+
+// keysWithPrefix collects the keys in b that start with prefix.
+// Keys are copied so that they remain valid while b is modified.
+func keysWithPrefix(b *bolt.Bucket, prefix []byte) [][]byte {
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	return keys
+}
+
+// containsKey returns true if keys, which must be sorted, contains key.
+func containsKey(keys [][]byte, key []byte) bool {
+	lo, hi := 0, len(keys)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		switch c := bytes.Compare(keys[mid], key); {
+		case c == 0:
+			return true
+		case c < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return false
+}
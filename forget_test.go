@@ -0,0 +1,175 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/boltdb/bolt"
+	"testing"
+)
+
+func TestDifferential_ForgetPrefix(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_forget_prefix")
+	defer done()
+
+	var (
+		a = []byte("tenant-a")
+		b = []byte("tenant-b")
+	)
+
+	add := func(objs ...Object) {
+		for _, obj := range objs {
+			if _, err := diff.Add(obj); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	add(
+		NewIDObject(CompositeID(a, []byte("1")), 1),
+		NewIDObject(CompositeID(a, []byte("2")), 2),
+		NewIDObject(CompositeID(b, []byte("1")), 3),
+	)
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	add(
+		NewIDObject(CompositeID(a, []byte("2")), 4),
+		NewIDObject(CompositeID(a, []byte("3")), 5),
+		NewIDObject(CompositeID(b, []byte("2")), 6),
+	)
+
+	removed, err := diff.ForgetPrefix(CompositeID(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Fatalf("Expected 3 IDs to be removed; got %d", removed)
+	}
+	if tracking := diff.CountTracking(); tracking != 1 {
+		t.Fatalf("Expected 1 tracked ID; got %d", tracking)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+}
+
+func TestDifferential_ForgetPrefixContext_Cancelled(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_forget_prefix")
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a1"), 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := diff.ForgetPrefixContext(ctx, []byte("a")); err != context.Canceled {
+		t.Fatalf("Expected %q; got %v", context.Canceled, err)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+}
+
+func TestDifferential_ForgetPrefix_Sequence(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_forget_prefix_sequence", WithSequenceNumbers())
+	defer done()
+
+	for _, id := range []string{"a1", "a2", "b1"} {
+		if _, err := diff.Add(NewIDObject([]byte(id), id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := diff.ForgetPrefix([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := diff.ViewUserDataTx(func(tx *bolt.Tx, _ *bolt.Bucket) error {
+		if n := tx.Bucket(diff.q).Bucket(bucketSequence).Stats().KeyN; n != 1 {
+			t.Errorf("Expected only the sequence number of b1 to remain; got %d sequence numbers", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDifferential_ForgetBatch(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_forget_batch")
+	defer done()
+
+	for i := 0; i < 3; i++ {
+		if _, err := diff.Add(NewIDObject([]byte{byte(i)}, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	// A pending change to a committed ID and a pending change to a new ID
+	for i := 2; i < 4; i++ {
+		if _, err := diff.Add(NewIDObject([]byte{byte(i)}, i+10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := diff.ForgetBatch([][]byte{{0}, {2}, {3}, {9}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Fatalf("Expected 3 IDs to be removed; got %d", removed)
+	}
+	if tracking := diff.CountTracking(); tracking != 1 {
+		t.Fatalf("Expected 1 tracked ID; got %d", tracking)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected 0 pending changes; got %d", pending)
+	}
+	if err := diff.AuditInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDifferential_ForgetBatchContext_Cancelled(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_forget_batch")
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := diff.ForgetBatchContext(ctx, [][]byte{[]byte("a")}); err != context.Canceled {
+		t.Fatalf("Expected %q; got %v", context.Canceled, err)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+}
+
+func TestDifferential_ForgetBatch_Held(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_forget_batch_held")
+	defer done()
+
+	if err := diff.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.ForgetBatch([][]byte{[]byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+
+	flushed, err := diff.Resume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flushed != 0 {
+		t.Fatalf("Expected the held change of a to be forgotten; got %d flushed", flushed)
+	}
+}
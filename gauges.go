@@ -0,0 +1,84 @@
+package diffdb
+
+import "github.com/boltdb/bolt"
+
+// Gauges is a snapshot of the current state of a differential, suitable for exposing as metrics.
+type Gauges struct {
+	// Tracking is the number of IDs with a committed hash.
+	Tracking int
+	// Pending is the number of pending changes.
+	Pending int
+	// Failed is the number of pending changes that failed to apply.
+	Failed int
+	// Orphans is the number of stored payloads not referenced by any pending change.
+	// For a differential using WithSharedContent, it is the number of payloads in the shared store
+	// without any reference from any differential.
+	Orphans int
+	// Size is the estimated number of bytes in use by the differential in the database file.
+	Size int
+}
+
+// Gauges returns a snapshot of the differential's gauges read in a single transaction.
+// Unlike an Observer, gauges are only computed when requested, so they can be scraped on an interval.
+// Counting orphans requires scanning the stored payloads, so the cost of Gauges grows with the number of them.
+func (diff *Differential) Gauges() (g Gauges, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		var (
+			b   = tx.Bucket(diff.q)
+			bph = b.Bucket(bucketPendingHashes)
+		)
+
+		g.Tracking = b.Bucket(bucketHashes).Stats().KeyN
+		g.Pending = bph.Stats().KeyN
+		g.Failed = b.Bucket(bucketFailed).Stats().KeyN
+
+		orphans, err := countOrphans(b)
+		if err != nil {
+			return err
+		}
+		g.Orphans = orphans
+
+		stats := b.Stats()
+		g.Size = stats.BranchInuse + stats.LeafInuse
+		return nil
+	})
+	if err != nil {
+		return Gauges{}, err
+	}
+	return
+}
+
+// countOrphans counts the payloads in the payload store of the differential bucket b that are not referenced.
+// Payloads in the shared store are referenced by every differential using it, so they are counted by reference count
+// rather than by the pending changes of b.
+func countOrphans(b *bolt.Bucket) (n int, err error) {
+	switch store := payloadsOf(b).(type) {
+	case sharedStore:
+		bc, br := store.meta.Bucket(bucketContent), store.meta.Bucket(bucketContentRefs)
+		if bc == nil {
+			return 0, nil
+		}
+		err = bc.ForEach(func(hash, _ []byte) error {
+			if br == nil || br.Get(hash) == nil {
+				n++
+			}
+			return nil
+		})
+	case *bolt.Bucket:
+		var referenced = make(map[string]struct{})
+		err = b.Bucket(bucketPendingHashes).ForEach(func(_, hash []byte) error {
+			referenced[string(hash)] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		err = store.ForEach(func(hash, _ []byte) error {
+			if _, ok := referenced[string(hash)]; !ok {
+				n++
+			}
+			return nil
+		})
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"github.com/boltdb/bolt"
+	"testing"
+)
+
+func TestDifferential_Gauges(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_gauges")
+	defer done()
+
+	for i, id := range []string{"a", "b", "c"} {
+		if _, err := diff.Add(NewIDObject([]byte(id), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		if string(id) == "b" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Expected an error from Each")
+	}
+
+	g, err := diff.Gauges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Tracking != 2 || g.Pending != 1 || g.Failed != 1 || g.Orphans != 0 {
+		t.Fatalf("Unexpected gauges %+v", g)
+	}
+	if g.Size <= 0 {
+		t.Fatalf("Expected a positive size; got %d", g.Size)
+	}
+}
+
+func TestDifferential_Gauges_Orphans(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"local":  nil,
+		"shared": {WithSharedContent()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			diff, done := openTestDifferential(t, "test_gauges_orphans", opts...)
+			defer done()
+
+			if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+				t.Fatal(err)
+			}
+
+			// Store a payload that no pending change refers to
+			err := diff.db.Update(func(tx *bolt.Tx) error {
+				switch store := payloadsOf(tx.Bucket(diff.q)).(type) {
+				case sharedStore:
+					bc, err := store.meta.CreateBucketIfNotExists(bucketContent)
+					if err != nil {
+						return err
+					}
+					return bc.Put([]byte("orphan"), []byte{})
+				case *bolt.Bucket:
+					return store.Put([]byte("orphan"), []byte{})
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			g, err := diff.Gauges()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.Pending != 1 || g.Orphans != 1 {
+				t.Fatalf("Expected 1 pending change and 1 orphan; got %+v", g)
+			}
+		})
+	}
+}
+
+func TestDifferential_Gauges_Closed(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_gauges_closed")
+	defer done()
+
+	if err := diff.db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Gauges(); err != bolt.ErrDatabaseNotOpen {
+		t.Fatalf("Expected %q; got %v", bolt.ErrDatabaseNotOpen, err)
+	}
+}
@@ -0,0 +1,136 @@
+package diffdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/boltdb/bolt"
+	"github.com/mitchellh/hashstructure"
+	"sync"
+)
+
+// DefaultHash is the name of the hash algorithm used by differentials unless configured otherwise.
+// It hashes objects with github.com/mitchellh/hashstructure, which encodes integers in a fixed size and byte order,
+// so hashes are the same on every architecture. However, hashstructure does not guarantee that hashes are stable
+// between its own releases; use PortableHash for hashes that must remain stable across builds,
+// such as when a database is restored from a backup by a different program.
+const DefaultHash = "hashstructure64"
+
+// ErrUnknownHash indicates that a hash algorithm name has not been registered with RegisterHash.
+var ErrUnknownHash = errors.New("diffdb: unknown hash algorithm")
+
+// A HashFunc computes the content hash of a Go object used to detect changes.
+// Equal objects must always produce equal hashes, and every hash must have the same length.
+// A HashFunc must also accept a string: the empty string is hashed when a differential is opened
+// or its algorithm is changed with UseHash to learn the length of its hashes.
+type HashFunc func(x interface{}) ([]byte, error)
+
+var (
+	hashesMu sync.RWMutex
+	hashes   = map[string]HashFunc{
+		DefaultHash: hashStructure64,
+	}
+)
+
+var keyHashName = []byte("hash")
+
+// hashTagName is the struct tag used to exclude fields from hashing with `hash:"ignore"` or `hash:"-"`,
+// such as volatile metadata like fetch times that should not cause an object to be seen as changed.
+const hashTagName = "hash"
+
+// RegisterHash registers a named hash algorithm for use with HashOfWith and Differential.UseHash.
+// Registering a name that already exists replaces it.
+func RegisterHash(name string, f HashFunc) {
+	hashesMu.Lock()
+	defer hashesMu.Unlock()
+	hashes[name] = f
+}
+
+func lookupHash(name string) (HashFunc, error) {
+	hashesMu.RLock()
+	defer hashesMu.RUnlock()
+	f, ok := hashes[name]
+	if !ok {
+		return nil, ErrUnknownHash
+	}
+	return f, nil
+}
+
+// HashOf returns the hash of x using the default hash algorithm.
+// Unexported fields do not affect the hash, so changes to them are not detected.
+func HashOf(x interface{}) ([]byte, error) {
+	return hashStructure64(x)
+}
+
+// Equal reports whether a and b have the same hash using the default hash algorithm,
+// which is how a differential decides whether an object has changed.
+// This allows objects to be compared for changes without a database.
+func Equal(a, b interface{}) (bool, error) {
+	ha, err := HashOf(a)
+	if err != nil {
+		return false, err
+	}
+	hb, err := HashOf(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ha, hb), nil
+}
+
+// HashOfWith returns the hash of x using the named hash algorithm.
+func HashOfWith(name string, x interface{}) ([]byte, error) {
+	f, err := lookupHash(name)
+	if err != nil {
+		return nil, err
+	}
+	return f(x)
+}
+
+// hashStructure64 hashes x using hashstructure, encoding the result as a little endian uint64.
+// Only exported struct fields are hashed, and fields tagged with `hash:"ignore"` or `hash:"-"` are skipped.
+// Functions, channels and unsafe pointers cannot be hashed and cause an error wrapping ErrUnhashable
+// naming the offending field; use SkipUnhashableHash to skip them instead.
+func hashStructure64(x interface{}) ([]byte, error) {
+	// The options are modified by Hash, so they cannot be shared between calls
+	i, err := hashstructure.Hash(x, &hashstructure.HashOptions{TagName: hashTagName})
+	if err != nil {
+		return nil, describeUnhashable(x, err)
+	}
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, i)
+	return b, nil
+}
+
+// HashName returns the name of the hash algorithm used by the differential.
+func (diff *Differential) HashName() string {
+	return diff.hashName
+}
+
+// UseHash sets the named hash algorithm used by the differential to detect changes.
+// The algorithm name is persisted so that it is used when the differential is next opened,
+// in which case the algorithm must have been registered before calling Open.
+// Changing the hash algorithm of a differential that already tracks objects
+// will cause every object to be seen as changed the next time it is added.
+func (diff *Differential) UseHash(name string) error {
+	f, err := lookupHash(name)
+	if err != nil {
+		return err
+	}
+	n, err := probeHashLen(f)
+	if err != nil {
+		return err
+	}
+
+	return diff.updateOp(func(tx *bolt.Tx) error {
+		tx.OnCommit(func() {
+			diff.hashName = name
+			diff.hash = f
+			diff.hashLen = n
+		})
+		b := tx.Bucket(diff.q)
+		if err := putHashLen(b, n); err != nil {
+			return err
+		}
+		return b.Bucket(bucketDiffMeta).Put(keyHashName, []byte(name))
+	})
+}
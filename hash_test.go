@@ -0,0 +1,254 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/boltdb/bolt"
+	"testing"
+	"time"
+)
+
+func TestHashOfWith(t *testing.T) {
+	a, err := HashOf("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := HashOfWith(DefaultHash, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Fatalf("Expected default hash %x to equal %x", b, a)
+	}
+
+	if _, err := HashOfWith("unknown", "abc"); err != ErrUnknownHash {
+		t.Fatalf("Expected %q; got %v", ErrUnknownHash, err)
+	}
+}
+
+func TestDifferential_UseHash(t *testing.T) {
+	RegisterHash("constant", func(x interface{}) ([]byte, error) {
+		return []byte("constant"), nil
+	})
+
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("test_use_hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.HashName() != DefaultHash {
+		t.Fatalf("Expected hash %q; got %q", DefaultHash, diff.HashName())
+	}
+	if err := diff.UseHash("constant"); err != nil {
+		t.Fatal(err)
+	}
+
+	if updated, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil || !updated {
+		t.Fatalf("Expected first add to update; got %v %v", updated, err)
+	}
+	if updated, err := diff.Add(NewIDObject([]byte("a"), 2)); err != nil || updated {
+		t.Fatalf("Expected constant hash to deduplicate; got %v %v", updated, err)
+	}
+
+	diff, err = db.Open("test_use_hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.HashName() != "constant" {
+		t.Fatalf("Expected persisted hash %q; got %q", "constant", diff.HashName())
+	}
+}
+
+func TestEqual(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	pairs := []struct {
+		a, b interface{}
+	}{
+		{emailObject{Id: "1", Email: "a@example.com"}, emailObject{Id: "1", Email: "a@example.com"}},
+		{emailObject{Id: "2", Email: "a@example.com"}, emailObject{Id: "2", Email: "b@example.com"}},
+		{NewIDObject([]byte("3"), 1), NewIDObject([]byte("3"), 1)},
+		{NewIDObject([]byte("4"), 1), NewIDObject([]byte("4"), 2)},
+	}
+
+	for i, p := range pairs {
+		equal, err := Equal(p.a, p.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Equal must agree with the change detection used by Add
+		if _, err := diff.Add(p.a.(Object)); err != nil {
+			t.Fatal(err)
+		}
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		updated, err := diff.Add(p.b.(Object))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated == equal {
+			t.Fatalf("%d: Equal returned %t but Add returned updated %t", i, equal, updated)
+		}
+	}
+}
+
+type fetchedObject struct {
+	Id        string
+	Name      string
+	FetchedAt time.Time `hash:"ignore"`
+	Source    string    `hash:"-"`
+}
+
+func (o fetchedObject) ID() []byte {
+	return []byte(o.Id)
+}
+
+func TestHashOf_IgnoredFields(t *testing.T) {
+	a := fetchedObject{Id: "1", Name: "a", FetchedAt: time.Unix(1, 0), Source: "x"}
+	b := fetchedObject{Id: "1", Name: "a", FetchedAt: time.Unix(2, 0), Source: "y"}
+
+	ha, err := HashOf(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb, err := HashOf(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ha, hb) {
+		t.Fatalf("Expected ignored fields not to affect the hash; got %x and %x", ha, hb)
+	}
+
+	b.Name = "b"
+	if hb, err = HashOf(b); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(ha, hb) {
+		t.Fatal("Expected a hashed field to affect the hash")
+	}
+}
+
+func TestDifferential_Add_IgnoredFields(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_ignored_fields")
+	defer done()
+
+	if _, err := diff.Add(fetchedObject{Id: "1", Name: "a", FetchedAt: time.Unix(1, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	refetched := fetchedObject{Id: "1", Name: "a", FetchedAt: time.Unix(2, 0), Source: "mirror"}
+	changed, err := diff.Changed(refetched.ID(), refetched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Fatal("Expected an object differing only in ignored fields not to be changed")
+	}
+	updated, err := diff.Add(refetched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated {
+		t.Fatal("Expected an object differing only in ignored fields not to be staged")
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected 0 pending changes; got %d", pending)
+	}
+
+	var applied int
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		applied++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if applied != 0 {
+		t.Fatalf("Expected no changes to apply; got %d", applied)
+	}
+
+	if updated, err = diff.Add(fetchedObject{Id: "1", Name: "b", FetchedAt: time.Unix(3, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Fatal("Expected a change to a hashed field to be staged")
+	}
+}
+
+func TestDifferential_HashLen(t *testing.T) {
+	RegisterHash("resized", func(x interface{}) ([]byte, error) {
+		return HashOf(x)
+	})
+
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("test_hash_len")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := diff.HashLen(); n != 8 {
+		t.Fatalf("Expected 8 byte hashes; got %d", n)
+	}
+	if err := diff.UseHash("resized"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replacing the algorithm with one that produces hashes of a different length must be detected on Open
+	RegisterHash("resized", func(x interface{}) ([]byte, error) {
+		h, err := HashOf(x)
+		return h[:4], err
+	})
+	if _, err := db.Open("test_hash_len"); !errors.Is(err, ErrHasherMismatch) {
+		t.Fatalf("Expected %q; got %v", ErrHasherMismatch, err)
+	}
+
+	// A differential without a recorded length is checked against its committed hashes
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("test_hash_len")).Bucket(bucketDiffMeta).Delete(keyHashLen)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Open("test_hash_len"); !errors.Is(err, ErrHasherMismatch) {
+		t.Fatalf("Expected %q without a recorded length; got %v", ErrHasherMismatch, err)
+	}
+}
+
+func TestDifferential_HashLen_RejectsString(t *testing.T) {
+	errNotStruct := errors.New("not a struct")
+	RegisterHash("structs_only", func(x interface{}) ([]byte, error) {
+		if _, ok := x.(string); ok {
+			return nil, errNotStruct
+		}
+		return HashOf(x)
+	})
+
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("test_hash_len_rejects_string")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.UseHash("structs_only"); !errors.Is(err, errNotStruct) {
+		t.Fatalf("Expected %q; got %v", errNotStruct, err)
+	}
+	if name := diff.HashName(); name != DefaultHash {
+		t.Fatalf("Expected the hash algorithm to be left unchanged; got %s", name)
+	}
+}
@@ -0,0 +1,33 @@
+package diffdb
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidHash indicates that a hash given to AddHashed is not the length produced by the differential's hash algorithm.
+var ErrInvalidHash = errors.New("diffdb: invalid hash length")
+
+// AddHashed adds x under id to the list of pending changes using hash as its content hash instead of hashing x.
+// This allows a fingerprint computed upstream, such as an HTTP ETag, to be trusted for change detection.
+// hash must be the same length as the hashes produced by the differential's hash algorithm
+// otherwise an error wrapping ErrInvalidHash is returned.
+// Mixing AddHashed and Add for the same ID will cause the object to be seen as changed
+// unless the provided hashes are produced by the same algorithm.
+func (diff *Differential) AddHashed(id, hash []byte, x interface{}) (changed bool, err error) {
+	if len(hash) != diff.hashLen {
+		return false, errors.Wrapf(ErrInvalidHash, "diffdb: AddHashed: got %d bytes, expected %d for %s", len(hash), diff.hashLen, diff.hashName)
+	}
+
+	if err = diff.ops.begin(); err != nil {
+		return
+	}
+	defer diff.ops.end()
+
+	err = diff.update(func(tx *bolt.Tx) error {
+		status, _, err := diff.stage(tx, id, x, hash, nil)
+		changed = status != addUnchanged
+		return err
+	})
+	return
+}
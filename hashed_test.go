@@ -0,0 +1,46 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDifferential_AddHashed(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	etag := []byte("etag0001")
+
+	changed, err := diff.AddHashed([]byte("a"), etag, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("Expected object to be changed")
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// The provided hash is trusted even though the payload differs
+	changed, err = diff.AddHashed([]byte("a"), etag, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Fatal("Expected object with the same hash to be unchanged")
+	}
+
+	committed, err := diff.CommittedHash([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(committed) != string(etag) {
+		t.Fatalf("Expected committed hash %q; got %q", etag, committed)
+	}
+
+	if _, err := diff.AddHashed([]byte("a"), []byte("short"), 2); !errors.Is(err, ErrInvalidHash) {
+		t.Fatalf("Expected %q; got %v", ErrInvalidHash, err)
+	}
+}
@@ -0,0 +1,97 @@
+package diffdb
+
+import (
+	"bytes"
+	"github.com/boltdb/bolt"
+)
+
+// HasHash reports whether any pending change or committed entry of the differential has the given hash.
+// Pending changes are found with a single lookup unless WithSharedContent is used,
+// while committed entries require a scan of every committed hash.
+func (diff *Differential) HasHash(hash []byte) (found bool, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diff.q)
+		found = hasPendingHash(b, hash) || hasCommittedHash(b, hash)
+		return nil
+	})
+	return
+}
+
+// HasPendingHash reports whether any pending change of the differential has the given hash.
+func (diff *Differential) HasPendingHash(hash []byte) (found bool, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		found = hasPendingHash(tx.Bucket(diff.q), hash)
+		return nil
+	})
+	return
+}
+
+// HasCommittedHash reports whether any committed entry of the differential has the given hash.
+// Committed hashes are keyed by ID so this scans every committed entry.
+func (diff *Differential) HasCommittedHash(hash []byte) (found bool, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		found = hasCommittedHash(tx.Bucket(diff.q), hash)
+		return nil
+	})
+	return
+}
+
+// hasPendingHash looks up hash in the payloads of the differential bucket b.
+// Payloads in the shared store may belong to other differentials so the pending hashes are scanned instead.
+func hasPendingHash(b *bolt.Bucket, hash []byte) bool {
+	if _, ok := payloadsOf(b).(sharedStore); !ok {
+		return b.Bucket(bucketPendingHashData).Get(hash) != nil
+	}
+
+	c := b.Bucket(bucketPendingHashes).Cursor()
+	for id, h := c.First(); id != nil; id, h = c.Next() {
+		if bytes.Equal(h, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCommittedHash scans the committed hashes of the differential bucket b for hash.
+func hasCommittedHash(b *bolt.Bucket, hash []byte) bool {
+	c := b.Bucket(bucketHashes).Cursor()
+	for id, h := c.First(); id != nil; id, h = c.Next() {
+		if bytes.Equal(h, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// DistinctHashes returns the number of distinct hashes among the pending changes of the differential.
+// Comparing it to CountChanges shows how many pending changes share a payload.
+func (diff *Differential) DistinctHashes() (n int, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		n = countDistinctValues(tx.Bucket(diff.q).Bucket(bucketPendingHashes))
+		return nil
+	})
+	return
+}
+
+// DistinctCommittedHashes returns the number of distinct committed hashes of the differential.
+// Comparing it to CountTracking shows how many tracked IDs have identical content.
+func (diff *Differential) DistinctCommittedHashes() (n int, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		n = countDistinctValues(tx.Bucket(diff.q).Bucket(bucketHashes))
+		return nil
+	})
+	return
+}
+
+// countDistinctValues returns the number of distinct non-empty values in b,
+// so that the tombstones of IDs deleted with Remove are not counted as hashes.
+func countDistinctValues(b *bolt.Bucket) int {
+	seen := make(map[string]struct{})
+	b.ForEach(func(_, v []byte) error {
+		if len(v) > 0 {
+			seen[string(v)] = struct{}{}
+		}
+		return nil
+	})
+	return len(seen)
+}
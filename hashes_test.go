@@ -0,0 +1,88 @@
+package diffdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDifferential_HasHash(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	var (
+		a = NewIDObject([]byte("a"), 1)
+		b = NewIDObject([]byte("b"), 2)
+	)
+
+	for _, obj := range []Object{a, b} {
+		if _, err := diff.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.EachN(context.Background(), func(id []byte, data Decoder) error { return nil }, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ha, err := diff.hash(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb, err := diff.hash(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		name   string
+		f      func([]byte) (bool, error)
+		hash   []byte
+		expect bool
+	}{
+		{"HasHash committed", diff.HasHash, ha, true},
+		{"HasHash pending", diff.HasHash, hb, true},
+		{"HasHash unknown", diff.HasHash, []byte("unknown!"), false},
+		{"HasPendingHash committed", diff.HasPendingHash, ha, false},
+		{"HasPendingHash pending", diff.HasPendingHash, hb, true},
+		{"HasCommittedHash committed", diff.HasCommittedHash, ha, true},
+		{"HasCommittedHash pending", diff.HasCommittedHash, hb, false},
+	}
+	for _, c := range checks {
+		found, err := c.f(c.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != c.expect {
+			t.Fatalf("%s: expected %t; got %t", c.name, c.expect, found)
+		}
+	}
+}
+
+func TestDifferential_DistinctHashes(t *testing.T) {
+	diff, done := openTestDifferential(t, "test", WithTransform(func(x interface{}) (interface{}, error) {
+		// Hash only the content so that IDs with the same value share a hash
+		return x.(IDObject).Object, nil
+	}))
+	defer done()
+
+	for i, v := range []int{1, 1, 2} {
+		if _, err := diff.Add(NewIDObject([]byte{byte('a' + i)}, v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := diff.DistinctHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("Expected 2 distinct pending hashes; got %d", n)
+	}
+
+	n, err = diff.DistinctCommittedHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("Expected no committed hashes; got %d", n)
+	}
+}
@@ -0,0 +1,63 @@
+package diffdb
+
+import (
+	"encoding/binary"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// ErrHasherMismatch indicates that the hash algorithm of a differential produces hashes of a different length
+// than the hashes the differential was created with, such as when RegisterHash replaced the algorithm
+// with a different function under the same name. Comparing hashes of different algorithms would see every object as changed.
+var ErrHasherMismatch = errors.New("diffdb: hash algorithm does not match the hashes stored in the differential")
+
+var keyHashLen = []byte("hashlen")
+
+// probeHashLen returns the length of the hashes produced by f by hashing the empty string.
+// Hash algorithms are expected to produce hashes of a fixed length for any value.
+func probeHashLen(f HashFunc) (int, error) {
+	h, err := f("")
+	if err != nil {
+		return 0, errors.Wrap(err, "diffdb: hash algorithm must accept a string to probe its hash length")
+	}
+	return len(h), nil
+}
+
+// HashLen returns the length in bytes of the hashes produced by the hash algorithm of the differential.
+func (diff *Differential) HashLen() int {
+	return diff.hashLen
+}
+
+// storedHashLen returns the length of the hashes stored in the differential bucket b.
+// This is the length recorded when the differential was opened or its hash algorithm was changed with UseHash,
+// or for a differential last written by an older version of diffdb, the length of its first committed hash.
+// It is 0 if the length is unknown.
+func storedHashLen(b *bolt.Bucket) int {
+	if v := b.Bucket(bucketDiffMeta).Get(keyHashLen); v != nil {
+		n, _ := binary.Uvarint(v)
+		return int(n)
+	}
+	c := b.Bucket(bucketHashes).Cursor()
+	for _, h := c.First(); h != nil; _, h = c.Next() {
+		if !isTombstone(h) {
+			return len(h)
+		}
+	}
+	return 0
+}
+
+// checkHashLen returns an error wrapping ErrHasherMismatch if the hashes stored in the differential bucket b
+// are not of the length produced by its hash algorithm.
+func (diff *Differential) checkHashLen(b *bolt.Bucket) error {
+	if n := storedHashLen(b); n != 0 && n != diff.hashLen {
+		return errors.Wrapf(ErrHasherMismatch, "diffdb: %s produces %d byte hashes but the differential %s has %d byte hashes",
+			diff.hashName, diff.hashLen, diff.Name(), n)
+	}
+	return nil
+}
+
+// putHashLen records the length of the hashes produced by a hash algorithm in the differential bucket b.
+func putHashLen(b *bolt.Bucket, n int) error {
+	var v [binary.MaxVarintLen64]byte
+	return b.Bucket(bucketDiffMeta).Put(keyHashLen, v[:binary.PutUvarint(v[:], uint64(n))])
+}
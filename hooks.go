@@ -0,0 +1,53 @@
+package diffdb
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// A BeforeApplyHook is called with each pending change before it is given to the apply function.
+// Returning an error vetoes the change, which is then treated as a failed change,
+// while returning ErrSkip leaves the change pending without marking it as failed.
+// The decoder and id are only valid for the duration of the call.
+type BeforeApplyHook func(id []byte, data Decoder, tx *bolt.Tx) error
+
+// An AfterApplyHook is called with the ID of each change after its hash has been advanced.
+// Returning an error aborts the transaction, so that no change applied in it is committed.
+type AfterApplyHook func(id []byte, tx *bolt.Tx) error
+
+// OnBeforeApply registers f to be called within the transaction used to apply each pending change,
+// after the validator and before the apply function, such as to emit an event or veto a change.
+// Registering a nil hook removes it.
+func (diff *Differential) OnBeforeApply(f BeforeApplyHook) {
+	diff.beforeApply = f
+}
+
+// OnAfterApply registers f to be called within the transaction used to apply each pending change
+// once it has been committed, such as to maintain a secondary index in user data
+// that remains consistent with the committed hashes.
+// Registering a nil hook removes it.
+func (diff *Differential) OnAfterApply(f AfterApplyHook) {
+	diff.afterApply = f
+}
+
+// vet runs the validator and the before apply hook on the change of id,
+// returning the first error that prevents the change from being applied.
+func (diff *Differential) vet(id []byte, data Decoder, tx *bolt.Tx) error {
+	if diff.validator != nil {
+		if err := diff.validator(id, data); err != nil {
+			return err
+		}
+	}
+	if diff.beforeApply != nil {
+		return diff.beforeApply(id, data, tx)
+	}
+	return nil
+}
+
+// applied runs the after apply hook on the change of id once it has been committed.
+func (diff *Differential) applied(id []byte, tx *bolt.Tx) error {
+	if diff.afterApply == nil {
+		return nil
+	}
+	return errors.Wrapf(diff.afterApply(id, tx), "diffdb: Each: after apply hook for id %x", id)
+}
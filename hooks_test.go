@@ -0,0 +1,78 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"github.com/boltdb/bolt"
+	"strconv"
+	"testing"
+)
+
+func TestDifferential_ApplyHooks(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_apply_hooks")
+	defer done()
+
+	for i := 0; i < 3; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var errVeto = errors.New("veto")
+	var before, applied int
+	diff.OnBeforeApply(func(id []byte, data Decoder, tx *bolt.Tx) error {
+		before++
+		if string(id) == "1" {
+			return errVeto
+		}
+		return nil
+	})
+	diff.OnAfterApply(func(id []byte, tx *bolt.Tx) error {
+		// Maintain an index of applied IDs in user data within the same transaction
+		return tx.Bucket(diff.q).Bucket(bucketUserData).Put(append([]byte("applied."), id...), nil)
+	})
+
+	err := diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		applied++
+		return nil
+	})
+	if !errors.Is(err, errVeto) {
+		t.Fatalf("Expected %q; got %v", errVeto, err)
+	}
+	if before != 3 || applied != 2 {
+		t.Fatalf("Expected 3 hooked and 2 applied changes; got %d and %d", before, applied)
+	}
+
+	failed, err := diff.Failed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || string(failed[0]) != "1" {
+		t.Fatalf("Expected the vetoed change to be failed; got %q", failed)
+	}
+	err = diff.ViewUserData(func(b *bolt.Bucket) error {
+		for _, id := range []string{"0", "2"} {
+			if v := b.Get([]byte("applied." + id)); v == nil {
+				t.Errorf("Expected applied change %s to be indexed", id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An error from the after apply hook aborts the whole transaction
+	var errIndex = errors.New("index")
+	diff.OnBeforeApply(nil)
+	diff.OnAfterApply(func(id []byte, tx *bolt.Tx) error {
+		return errIndex
+	})
+	err = diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil })
+	if !errors.Is(err, errIndex) {
+		t.Fatalf("Expected %q; got %v", errIndex, err)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+}
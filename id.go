@@ -0,0 +1,69 @@
+package diffdb
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	// ErrInvalidCompositeID indicates that an ID given to DecodeCompositeID was not created by CompositeID.
+	ErrInvalidCompositeID = errors.New("diffdb: invalid composite ID")
+
+	// ErrInvalidUint64ID indicates that an ID given to DecodeUint64ID was not created by Uint64ID.
+	ErrInvalidUint64ID = errors.New("diffdb: invalid uint64 ID")
+)
+
+// CompositeID builds an unambiguous ID from multiple parts, such as a tenant and entity ID.
+// Each part is prefixed by its length so that, unlike plain concatenation,
+// the parts ("ab", "c") and ("a", "bc") produce different IDs.
+// The composite ID of a leading subset of parts is a prefix of the full composite ID,
+// so CompositeID(tenant) can be used to scan all IDs created with CompositeID(tenant, entity).
+// This is the recommended way to build IDs from multiple values.
+func CompositeID(parts ...[]byte) []byte {
+	var size int
+	for _, p := range parts {
+		size += binary.MaxVarintLen64 + len(p)
+	}
+
+	id := make([]byte, 0, size)
+	var prefix [binary.MaxVarintLen64]byte
+	for _, p := range parts {
+		id = append(id, prefix[:binary.PutUvarint(prefix[:], uint64(len(p)))]...)
+		id = append(id, p...)
+	}
+	return id
+}
+
+// DecodeCompositeID splits an ID created with CompositeID back into its parts.
+func DecodeCompositeID(id []byte) ([][]byte, error) {
+	var parts [][]byte
+	for len(id) > 0 {
+		n, read := binary.Uvarint(id)
+		if read <= 0 || uint64(len(id)-read) < n {
+			return nil, ErrInvalidCompositeID
+		}
+		id = id[read:]
+		parts = append(parts, id[:n:n])
+		id = id[n:]
+	}
+	return parts, nil
+}
+
+// Uint64ID encodes n as an 8 byte big endian ID.
+// BoltDB orders keys lexicographically, so numeric IDs formatted as strings sort "10" before "2";
+// big endian IDs sort in numeric order so that prefix scans and ordered iteration such as Each behave intuitively.
+// Little endian encoding, as used for the hashes returned by HashOf, does not preserve ordering and should not be used for IDs.
+// Uint64ID can also be used as a part of CompositeID.
+func Uint64ID(n uint64) []byte {
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, n)
+	return id
+}
+
+// DecodeUint64ID decodes an ID created with Uint64ID.
+func DecodeUint64ID(id []byte) (uint64, error) {
+	if len(id) != 8 {
+		return 0, ErrInvalidUint64ID
+	}
+	return binary.BigEndian.Uint64(id), nil
+}
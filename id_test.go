@@ -0,0 +1,51 @@
+package diffdb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompositeID(t *testing.T) {
+	a := CompositeID([]byte("ab"), []byte("c"))
+	b := CompositeID([]byte("a"), []byte("bc"))
+	if bytes.Equal(a, b) {
+		t.Fatalf("Expected composite IDs to differ; got %x", a)
+	}
+
+	if !bytes.HasPrefix(a, CompositeID([]byte("ab"))) {
+		t.Fatal("Expected composite ID of leading parts to be a prefix")
+	}
+
+	parts, err := DecodeCompositeID(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 || string(parts[0]) != "ab" || string(parts[1]) != "c" {
+		t.Fatalf("Unexpected parts %q", parts)
+	}
+
+	if _, err := DecodeCompositeID(a[:len(a)-1]); err != ErrInvalidCompositeID {
+		t.Fatalf("Expected %q; got %v", ErrInvalidCompositeID, err)
+	}
+}
+
+func TestUint64ID(t *testing.T) {
+	if bytes.Compare(Uint64ID(2), Uint64ID(10)) >= 0 {
+		t.Fatal("Expected Uint64ID(2) to sort before Uint64ID(10)")
+	}
+	if bytes.Compare(Uint64ID(255), Uint64ID(256)) >= 0 {
+		t.Fatal("Expected Uint64ID(255) to sort before Uint64ID(256)")
+	}
+
+	n, err := DecodeUint64ID(Uint64ID(1234))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1234 {
+		t.Fatalf("Expected 1234; got %d", n)
+	}
+
+	if _, err := DecodeUint64ID([]byte("short")); err != ErrInvalidUint64ID {
+		t.Fatalf("Expected %q; got %v", ErrInvalidUint64ID, err)
+	}
+}
@@ -0,0 +1,53 @@
+package diffdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+// Test that reads started before or during Each see the state from before Each started.
+func TestDifferential_Each_Isolation(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_isolation", WithReserve(10000))
+	defer done()
+
+	for i := 0; i < 5; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	it, err := diff.PendingIterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	err = diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		if pending := diff.CountChanges(); pending != 5 {
+			t.Errorf("Expected 5 pending changes during Each; got %d", pending)
+		}
+		if tracking := diff.CountTracking(); tracking != 0 {
+			t.Errorf("Expected nothing to be tracked during Each; got %d", tracking)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for it.Next() {
+		n++
+	}
+	if n != 5 {
+		t.Fatalf("Expected iterator started before Each to see 5 pending changes; got %d", n)
+	}
+
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected 0 pending changes after Each; got %d", pending)
+	}
+	if tracking := diff.CountTracking(); tracking != 5 {
+		t.Fatalf("Expected 5 tracked items after Each; got %d", tracking)
+	}
+}
@@ -0,0 +1,124 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"github.com/boltdb/bolt"
+)
+
+// PendingIter is a pull-style iterator over the pending changes of a differential in ID order.
+// It holds a read transaction open for its lifetime, so Close must be called once iteration is finished.
+// Iterating does not modify the differential.
+type PendingIter struct {
+	tx      *bolt.Tx
+	cur     *bolt.Cursor
+	bphd    payloadStore
+	started bool
+
+	id, hash []byte
+	decoder  msgpackDecoder
+}
+
+// PendingIterator returns an iterator over the pending changes of the differential.
+// The iterator sees a consistent snapshot of the pending changes as of the time it was created.
+func (diff *Differential) PendingIterator() (*PendingIter, error) {
+	tx, err := diff.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+
+	b := tx.Bucket(diff.q)
+	return &PendingIter{
+		tx:   tx,
+		cur:  b.Bucket(bucketPendingHashes).Cursor(),
+		bphd: payloadsOf(b),
+	}, nil
+}
+
+// Next advances the iterator to the next pending change, returning false when there are no more changes.
+func (it *PendingIter) Next() bool {
+	if it.cur == nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.id, it.hash = it.cur.First()
+	} else {
+		it.id, it.hash = it.cur.Next()
+	}
+	it.decoder.data = it.bphd.Get(it.hash)
+	return it.id != nil
+}
+
+// ID returns the ID of the current pending change.
+// The returned slice is only valid until the iterator is closed.
+func (it *PendingIter) ID() []byte {
+	return it.id
+}
+
+// Hash returns the hash of the current pending change.
+// The returned slice is only valid until the iterator is closed.
+func (it *PendingIter) Hash() []byte {
+	return it.hash
+}
+
+// Decode decodes the payload of the current pending change into x.
+func (it *PendingIter) Decode(x interface{}) error {
+	return it.decoder.Decode(x)
+}
+
+// Close releases the read transaction held by the iterator.
+func (it *PendingIter) Close() error {
+	if it.cur == nil {
+		return nil
+	}
+	it.cur = nil
+	return it.tx.Rollback()
+}
+
+// StateFunc is called by EachState with the state of each ID.
+// committed is the committed hash of id, which is nil if id has no committed hash
+// and empty if id has been deleted with Remove, and pending is true if id has a pending change.
+// The slices are only valid for the duration of the call.
+type StateFunc func(id []byte, committed []byte, pending bool) error
+
+// EachState calls f with the state of each ID that has a committed hash or a pending change, in ID order,
+// giving a complete picture of the differential in a single pass such as for reconciliation or debugging.
+// The state is read from a single read transaction and the differential is not modified.
+// Iteration stops at the first error returned by f, which is returned, or when ctx is cancelled.
+func (diff *Differential) EachState(ctx context.Context, f StateFunc) error {
+	return diff.db.View(func(tx *bolt.Tx) error {
+		var (
+			b  = tx.Bucket(diff.q)
+			ch = b.Bucket(bucketHashes).Cursor()
+			cp = b.Bucket(bucketPendingHashes).Cursor()
+		)
+
+		committedID, committed := ch.First()
+		pendingID, _ := cp.First()
+		for committedID != nil || pendingID != nil {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			// Merge the committed and pending IDs, which are both in ID order
+			var err error
+			switch c := bytes.Compare(committedID, pendingID); {
+			case pendingID == nil || committedID != nil && c < 0:
+				err = f(committedID, committed, false)
+				committedID, committed = ch.Next()
+			case committedID == nil || c > 0:
+				err = f(pendingID, nil, true)
+				pendingID, _ = cp.Next()
+			default:
+				err = f(committedID, committed, true)
+				committedID, committed = ch.Next()
+				pendingID, _ = cp.Next()
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
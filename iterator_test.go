@@ -0,0 +1,98 @@
+package diffdb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDifferential_PendingIterator(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_pending_iterator")
+	defer done()
+
+	for i := 0; i < 3; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	it, err := diff.PendingIterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	var i int
+	for ; it.Next(); i++ {
+		if string(it.ID()) != strconv.Itoa(i) {
+			t.Fatalf("Expected ID %d; got %q", i, it.ID())
+		}
+		var v IDObject
+		if err := it.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Object != strconv.Itoa(i) {
+			t.Fatalf("Expected value %d; got %v", i, v.Object)
+		}
+	}
+	if i != 3 {
+		t.Fatalf("Expected 3 pending changes; got %d", i)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if it.Next() {
+		t.Fatal("Expected Next to return false after Close")
+	}
+
+	if pending := diff.CountChanges(); pending != 3 {
+		t.Fatalf("Expected iteration not to modify pending changes; got %d", pending)
+	}
+}
+
+func TestDifferential_EachState(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_state")
+	defer done()
+
+	for i := 0; i < 3; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < 5; i += 2 {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i+10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Remove([]byte("2")); err != nil {
+		t.Fatal(err)
+	}
+
+	var states []string
+	err := diff.EachState(context.Background(), func(id []byte, committed []byte, pending bool) error {
+		var state string
+		switch {
+		case committed == nil:
+			state = "new"
+		case len(committed) == 0:
+			state = "deleted"
+		default:
+			state = "committed"
+		}
+		states = append(states, fmt.Sprintf("%s:%s:%v", id, state, pending))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "0:committed:false,1:committed:true,2:deleted:false,3:new:true"
+	if got := strings.Join(states, ","); got != expect {
+		t.Fatalf("Expected states %s; got %s", expect, got)
+	}
+}
@@ -0,0 +1,34 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/boltdb/bolt"
+)
+
+// EachLabeled is like Each but stamps every change it applies with label, such as a commit SHA or run ID,
+// recording which run last applied each ID. The label of an ID can be retrieved with BatchOf.
+func (diff *Differential) EachLabeled(ctx context.Context, label string, f ApplyFunc) error {
+	return diff.each(ctx, func(id []byte, meta ChangeMeta, data Decoder, tx *bolt.Tx) error {
+		if err := f(id, data); err != nil {
+			return err
+		}
+
+		b, err := tx.Bucket(diff.q).CreateBucketIfNotExists(bucketBatchLabels)
+		if err != nil {
+			return err
+		}
+		return b.Put(id, []byte(label))
+	}, -1, openPendingCursor)
+}
+
+// BatchOf returns the label given to EachLabeled by the run that last applied id.
+// It returns an empty string if id has never been applied by EachLabeled.
+func (diff *Differential) BatchOf(id []byte) (label string, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(diff.q).Bucket(bucketBatchLabels); b != nil {
+			label = string(b.Get(id))
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,39 @@
+package diffdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDifferential_EachLabeled(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	apply := func(id []byte, data Decoder) error { return nil }
+
+	for _, obj := range []Object{NewIDObject([]byte("a"), 1), NewIDObject([]byte("b"), 2)} {
+		if _, err := diff.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.EachLabeled(context.Background(), "run-1", apply); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := diff.Add(NewIDObject([]byte("b"), 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.EachLabeled(context.Background(), "run-2", apply); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, expect := range map[string]string{"a": "run-1", "b": "run-2", "c": ""} {
+		label, err := diff.BatchOf([]byte(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if label != expect {
+			t.Fatalf("Expected label of %s to be %q; got %q", id, expect, label)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package diffdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// ErrInvalidManifest indicates that a manifest given to CompareManifest was not written by Manifest.
+var ErrInvalidManifest = errors.New("diffdb: invalid manifest")
+
+// Manifest writes every committed (ID, hash) pair of the differential to w in ID order, without any payloads.
+// Each pair is written as the length of the ID as a uvarint, the ID, the length of the hash as a uvarint and the hash.
+// Manifests are compact enough to be exchanged with a remote copy of the differential
+// and compared with CompareManifest, so that only the payloads of the IDs that differ need to be transferred.
+// The manifest is written from a single read transaction so it is a consistent snapshot.
+func (diff *Differential) Manifest(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	err := diff.db.View(func(tx *bolt.Tx) error {
+		var prefix [binary.MaxVarintLen64]byte
+		return tx.Bucket(diff.q).Bucket(bucketHashes).ForEach(func(id, hash []byte) error {
+			bw.Write(prefix[:binary.PutUvarint(prefix[:], uint64(len(id)))])
+			bw.Write(id)
+			bw.Write(prefix[:binary.PutUvarint(prefix[:], uint64(len(hash)))])
+			_, err := bw.Write(hash)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// CompareManifest reads a manifest written by Manifest, typically from a remote copy of the differential,
+// and returns the IDs in ID order whose committed hash differs from the manifest,
+// including IDs that are only committed locally and IDs that are only in the manifest.
+// A manifest that is malformed or not in ID order returns an error wrapping ErrInvalidManifest.
+func (diff *Differential) CompareManifest(r io.Reader) (diffIDs [][]byte, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		diffIDs, err = diff.compareManifestTx(tx, r)
+		return err
+	})
+	return
+}
+
+// compareManifestTx is like CompareManifest but compares the committed hashes within tx.
+func (diff *Differential) compareManifestTx(tx *bolt.Tx, r io.Reader) (diffIDs [][]byte, err error) {
+	br := bufio.NewReader(r)
+	c := tx.Bucket(diff.q).Bucket(bucketHashes).Cursor()
+	id, hash := c.First()
+
+	var last []byte
+	for {
+		remoteID, remoteHash, err := readManifestEntry(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if last != nil && bytes.Compare(remoteID, last) <= 0 {
+			return nil, errors.Wrapf(ErrInvalidManifest, "diffdb: id %x is out of order", remoteID)
+		}
+		last = remoteID
+
+		// Local IDs before the remote ID are missing from the manifest
+		for ; id != nil && bytes.Compare(id, remoteID) < 0; id, hash = c.Next() {
+			diffIDs = append(diffIDs, append([]byte(nil), id...))
+		}
+		if id == nil || !bytes.Equal(id, remoteID) {
+			diffIDs = append(diffIDs, remoteID)
+			continue
+		}
+		if !bytes.Equal(hash, remoteHash) {
+			diffIDs = append(diffIDs, remoteID)
+		}
+		id, hash = c.Next()
+	}
+
+	for ; id != nil; id, _ = c.Next() {
+		diffIDs = append(diffIDs, append([]byte(nil), id...))
+	}
+	return diffIDs, nil
+}
+
+// readManifestEntry reads a single (ID, hash) pair written by Manifest.
+// io.EOF is returned if there are no more entries.
+func readManifestEntry(r *bufio.Reader) (id, hash []byte, err error) {
+	if id, err = readManifestField(r); err != nil {
+		return nil, nil, err
+	}
+	if hash, err = readManifestField(r); err == io.EOF {
+		err = errors.Wrap(ErrInvalidManifest, "diffdb: truncated entry")
+	}
+	return
+}
+
+// maxManifestField is the maximum length of an ID or hash accepted in a manifest,
+// guarding against allocating huge buffers for corrupt input.
+const maxManifestField = 1 << 20
+
+// readManifestField reads a single uvarint length-prefixed field.
+func readManifestField(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil || n > maxManifestField {
+		return nil, errors.Wrap(ErrInvalidManifest, "diffdb: bad field length")
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, errors.Wrap(ErrInvalidManifest, "diffdb: truncated entry")
+	}
+	return b, nil
+}
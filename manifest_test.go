@@ -0,0 +1,62 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDifferential_CompareManifest(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	apply := func(diff *Differential, objs map[string]string) {
+		for id, v := range objs {
+			if _, err := diff.Add(NewIDObject([]byte(id), v)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	local, err := db.Open("local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := db.Open("remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply(local, map[string]string{"a": "1", "b": "2", "c": "3", "e": "5"})
+	apply(remote, map[string]string{"a": "1", "b": "changed", "d": "4", "e": "5"})
+
+	var manifest bytes.Buffer
+	if err := remote.Manifest(&manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := local.CompareManifest(bytes.NewReader(manifest.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, id := range ids {
+		got = append(got, string(id))
+	}
+	if expect := "b,c,d"; strings.Join(got, ",") != expect {
+		t.Fatalf("Expected differing IDs %s; got %v", expect, got)
+	}
+
+	// Identical differentials have no differences
+	if ids, err := remote.CompareManifest(bytes.NewReader(manifest.Bytes())); err != nil || len(ids) != 0 {
+		t.Fatalf("Expected no differences; got %q (%v)", ids, err)
+	}
+
+	if _, err := local.CompareManifest(bytes.NewReader(manifest.Bytes()[:manifest.Len()-1])); !errors.Is(err, ErrInvalidManifest) {
+		t.Fatalf("Expected %q; got %v", ErrInvalidManifest, err)
+	}
+}
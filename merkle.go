@@ -0,0 +1,141 @@
+package diffdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/boltdb/bolt"
+)
+
+// A MerkleNode summarises the committed hashes of every ID that starts with Prefix.
+type MerkleNode struct {
+	// Prefix is the common prefix of the IDs summarised by the node.
+	Prefix []byte
+	// Digest is the XOR of the SHA-256 of each committed (ID, hash) pair starting with Prefix,
+	// computed in the same way as Checksum.
+	Digest []byte
+	// Count is the number of committed IDs starting with Prefix.
+	Count int
+}
+
+// MerkleRoot returns the digest of every committed (ID, hash) pair in the differential,
+// which is the root of the tree of digests returned by MerkleChildren. It is equal to Checksum.
+// Two differentials with the same MerkleRoot track the same IDs with the same hashes.
+func (diff *Differential) MerkleRoot() ([]byte, error) {
+	return diff.Checksum()
+}
+
+// MerkleChildren returns a node for each byte b such that a committed ID starts with prefix followed by b, in byte order.
+// The digest of prefix is the XOR of the digests of its children and, if prefix is itself a committed ID,
+// the digest of that ID alone.
+//
+// Two differentials, such as a local differential and a copy in another datacenter,
+// can be compared by exchanging only the digests of the ranges that differ, descending from the root
+// into the children whose digests differ; see MerkleDiff.
+func (diff *Differential) MerkleChildren(prefix []byte) (nodes []MerkleNode, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		nodes = nil
+		c := tx.Bucket(diff.q).Bucket(bucketHashes).Cursor()
+		for id, hash := c.Seek(prefix); id != nil && bytes.HasPrefix(id, prefix); id, hash = c.Next() {
+			if len(id) == len(prefix) {
+				continue
+			}
+
+			child := id[:len(prefix)+1]
+			if len(nodes) == 0 || !bytes.Equal(nodes[len(nodes)-1].Prefix, child) {
+				nodes = append(nodes, MerkleNode{
+					Prefix: append([]byte(nil), child...),
+					Digest: make([]byte, sha256.Size),
+				})
+			}
+
+			node := &nodes[len(nodes)-1]
+			entry := checksumEntry(id, hash)
+			xorDigest(node.Digest, entry[:])
+			node.Count++
+		}
+		return nil
+	})
+	return
+}
+
+// MerkleDiff compares the differential to a remote differential by descending the tree of digests
+// from the root into the ranges whose digests differ, and returns the IDs in ID order whose committed hash differs,
+// including IDs only committed on one side.
+// remote must return the result of MerkleChildren for the given prefix of the remote differential,
+// such as by calling it over the network, and is only called for ranges that differ.
+// When most of the dataset is identical this exchanges far less data than Manifest.
+func (diff *Differential) MerkleDiff(remote func(prefix []byte) ([]MerkleNode, error)) (diffIDs [][]byte, err error) {
+	localRoot, err := diff.MerkleRoot()
+	if err != nil {
+		return nil, err
+	}
+	remoteRootChildren, err := remote(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var descend func(prefix, localDigest, remoteDigest []byte) error
+	descend = func(prefix, localDigest, remoteDigest []byte) error {
+		if bytes.Equal(localDigest, remoteDigest) {
+			return nil
+		}
+
+		localChildren, err := diff.MerkleChildren(prefix)
+		if err != nil {
+			return err
+		}
+		remoteChildren := remoteRootChildren
+		if prefix != nil {
+			if remoteChildren, err = remote(prefix); err != nil {
+				return err
+			}
+		}
+
+		// Whatever is not covered by the children is the digest of the ID equal to prefix
+		if len(prefix) > 0 && !bytes.Equal(selfDigest(localDigest, localChildren), selfDigest(remoteDigest, remoteChildren)) {
+			diffIDs = append(diffIDs, append([]byte(nil), prefix...))
+		}
+
+		var zero = make([]byte, sha256.Size)
+		for len(localChildren) > 0 || len(remoteChildren) > 0 {
+			var l, r = zero, zero
+			var child []byte
+			switch {
+			case len(remoteChildren) == 0 || len(localChildren) > 0 && bytes.Compare(localChildren[0].Prefix, remoteChildren[0].Prefix) < 0:
+				child, l = localChildren[0].Prefix, localChildren[0].Digest
+				localChildren = localChildren[1:]
+			case len(localChildren) == 0 || bytes.Compare(remoteChildren[0].Prefix, localChildren[0].Prefix) < 0:
+				child, r = remoteChildren[0].Prefix, remoteChildren[0].Digest
+				remoteChildren = remoteChildren[1:]
+			default:
+				child, l, r = localChildren[0].Prefix, localChildren[0].Digest, remoteChildren[0].Digest
+				localChildren, remoteChildren = localChildren[1:], remoteChildren[1:]
+			}
+			if err := descend(child, l, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := descend(nil, localRoot, selfDigest(make([]byte, sha256.Size), remoteRootChildren)); err != nil {
+		return nil, err
+	}
+	return diffIDs, nil
+}
+
+// selfDigest returns digest with the digests of children removed.
+func selfDigest(digest []byte, children []MerkleNode) []byte {
+	self := append([]byte(nil), digest...)
+	for _, child := range children {
+		xorDigest(self, child.Digest)
+	}
+	return self
+}
+
+// xorDigest XORs src into dst.
+func xorDigest(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
@@ -0,0 +1,76 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDifferential_MerkleDiff(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	apply := func(diff *Differential, objs map[string]string) {
+		for id, v := range objs {
+			if _, err := diff.Add(NewIDObject([]byte(id), v)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	local, err := db.Open("local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := db.Open("remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply(local, map[string]string{"a": "1", "ab": "2", "abc": "3", "b": "4", "ca": "5"})
+	apply(remote, map[string]string{"a": "1", "ab": "changed", "abc": "3", "bb": "6", "ca": "5"})
+
+	root, err := local.MerkleRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := local.MerkleChildren(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 3 || children[0].Count != 3 || !bytes.Equal(selfDigest(root, children), make([]byte, len(root))) {
+		t.Fatalf("Expected the root to be the XOR of its children; got %+v", children)
+	}
+
+	var fetched []string
+	ids, err := local.MerkleDiff(func(prefix []byte) ([]MerkleNode, error) {
+		fetched = append(fetched, string(prefix))
+		return remote.MerkleChildren(prefix)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, id := range ids {
+		got = append(got, string(id))
+	}
+	if expect := "ab,b,bb"; strings.Join(got, ",") != expect {
+		t.Fatalf("Expected differing IDs %s; got %v", expect, got)
+	}
+	for _, prefix := range fetched {
+		if prefix == "c" {
+			t.Fatal("Expected identical ranges not to be descended")
+		}
+	}
+
+	ids, err = remote.MerkleDiff(remote.MerkleChildren)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatalf("Expected no differences; got %q", ids)
+	}
+}
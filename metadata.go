@@ -0,0 +1,55 @@
+package diffdb
+
+import (
+	"github.com/boltdb/bolt"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+var keyMetadata = []byte("metadata")
+
+// Metadata describes a differential itself, as opposed to the objects it tracks,
+// so that a database containing many differentials is self-documenting.
+type Metadata struct {
+	// Owner is the team or person responsible for the differential.
+	Owner string
+	// Description is a human-readable description of what the differential tracks.
+	Description string
+	// Source identifies where the tracked objects come from, such as a table name.
+	Source string
+	// Tags holds any other metadata.
+	Tags map[string]string
+}
+
+// SetMetadata replaces the metadata of the differential called name.
+// It returns ErrNoDifferential if the differential does not exist.
+func (db *DB) SetMetadata(name string, m Metadata) error {
+	data, err := msgpack.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return db.updateOp(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(name))
+		if b == nil || b.Bucket(bucketDiffMeta) == nil {
+			return ErrNoDifferential
+		}
+		return b.Bucket(bucketDiffMeta).Put(keyMetadata, data)
+	})
+}
+
+// Describe returns the metadata of the differential called name without opening it,
+// or the zero Metadata if none has been set with SetMetadata.
+// It returns ErrNoDifferential if the differential does not exist.
+func (db *DB) Describe(name string) (m Metadata, err error) {
+	err = db.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(name))
+		if b == nil || b.Bucket(bucketDiffMeta) == nil {
+			return ErrNoDifferential
+		}
+		data := b.Bucket(bucketDiffMeta).Get(keyMetadata)
+		if data == nil {
+			return nil
+		}
+		return msgpack.Unmarshal(data, &m)
+	})
+	return
+}
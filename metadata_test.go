@@ -0,0 +1,46 @@
+package diffdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDB_Describe(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	if _, err := db.Open("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := db.Describe("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, Metadata{}) {
+		t.Fatalf("Expected no metadata; got %+v", m)
+	}
+
+	expect := Metadata{
+		Owner:       "platform",
+		Description: "Users synchronised to the CRM",
+		Source:      "public.users",
+		Tags:        map[string]string{"tier": "1"},
+	}
+	if err := db.SetMetadata("users", expect); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = db.Describe("users"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, expect) {
+		t.Fatalf("Expected metadata %+v; got %+v", expect, m)
+	}
+
+	if err := db.SetMetadata("missing", expect); err != ErrNoDifferential {
+		t.Fatalf("Expected %q; got %v", ErrNoDifferential, err)
+	}
+	if _, err := db.Describe("missing"); err != ErrNoDifferential {
+		t.Fatalf("Expected %q; got %v", ErrNoDifferential, err)
+	}
+}
@@ -0,0 +1,88 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"github.com/boltdb/bolt"
+)
+
+// MapFunc is given the ID and committed payload of each object passed to MapCommitted
+// and returns the object to replace it with.
+// If it returns ErrSkip then the committed object is left unchanged.
+type MapFunc func(id []byte, old Decoder) (interface{}, error)
+
+// MapCommitted re-encodes every committed object retained by WithRetainCommitted,
+// replacing it and its committed hash with the object returned by f.
+// This is intended for migrating the stored objects after a change to their schema,
+// so that unchanged objects are not seen as changed the next time they are added.
+// Pending changes are not affected.
+//
+// All objects are migrated in a single transaction. If f returns an error or the context is cancelled
+// then no objects are migrated and that error is returned.
+// Objects applied without WithRetainCommitted have no stored payload and are not given to f,
+// and neither are objects deleted with Remove.
+func (diff *Differential) MapCommitted(ctx context.Context, f MapFunc) error {
+	if err := diff.ops.begin(); err != nil {
+		return err
+	}
+	defer diff.ops.end()
+
+	return diff.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diff.q)
+		bcd := b.Bucket(bucketCommittedData)
+		if bcd == nil {
+			return nil
+		}
+		bh := b.Bucket(bucketHashes)
+
+		// Collect the IDs first as the bucket cannot be modified while it is being iterated
+		ids := keysWithPrefix(bcd, nil)
+
+		decoder := new(msgpackDecoder)
+		for _, id := range ids {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+
+			// Deleted IDs must not be given a committed hash again
+			if isTombstone(bh.Get(id)) {
+				continue
+			}
+
+			decoder.data = bcd.Get(id)
+			x, err := f(id, decoder)
+			if errors.Is(err, ErrSkip) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if diff.transform != nil {
+				x, err = diff.transform(x)
+				if err != nil {
+					return err
+				}
+			}
+
+			hash, err := diff.hash(x)
+			if err != nil {
+				return err
+			}
+			raw, err := encodePayload(x, diff.codec)
+			if err != nil {
+				return err
+			}
+
+			if err := bcd.Put(id, raw); err != nil {
+				return err
+			}
+			if err := bh.Put(id, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,97 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestDifferential_MapCommitted(t *testing.T) {
+	diff, done := openTestDifferential(t, "test", WithRetainCommitted())
+	defer done()
+
+	for i := 1; i <= 3; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Migrate every committed object to its new schema
+	err := diff.MapCommitted(context.Background(), func(id []byte, old Decoder) (interface{}, error) {
+		var obj struct {
+			Object int
+		}
+		if err := old.Decode(&obj); err != nil {
+			return nil, err
+		}
+		return NewIDObject(id, obj.Object*10), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		id := []byte(strconv.Itoa(i))
+		expect, err := diff.hash(NewIDObject(id, i*10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		committed, err := diff.CommittedHash(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(committed, expect) {
+			t.Fatalf("Expected committed hash of %s to be migrated", id)
+		}
+
+		updated, err := diff.Add(NewIDObject(id, i*10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated {
+			t.Fatalf("Expected migrated object %s to be unchanged", id)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := diff.MapCommitted(ctx, func(id []byte, old Decoder) (interface{}, error) { return nil, nil }); err != context.Canceled {
+		t.Fatalf("Expected %q; got %v", context.Canceled, err)
+	}
+}
+
+func TestDifferential_MapCommitted_SkipWrapped(t *testing.T) {
+	diff, done := openTestDifferential(t, "test", WithRetainCommitted())
+	defer done()
+
+	id := []byte("a")
+	if _, err := diff.Add(NewIDObject(id, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	before, err := diff.CommittedHash(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = diff.MapCommitted(context.Background(), func(id []byte, old Decoder) (interface{}, error) {
+		return nil, fmt.Errorf("unchanged: %w", ErrSkip)
+	})
+	if err != nil {
+		t.Fatalf("Expected a wrapped ErrSkip not to be reported as an error; got %v", err)
+	}
+	after, err := diff.CommittedHash(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatal("Expected the committed object to be left unchanged")
+	}
+}
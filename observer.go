@@ -0,0 +1,55 @@
+package diffdb
+
+import (
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+// An Observer receives instrumentation events from a differential database.
+// Observer methods are called synchronously, often while a BoltDB transaction is open,
+// so implementations must be cheap and must never block.
+// Each method is given the name of the differential the event occurred in.
+type Observer interface {
+	// ObserveAdd is called for each object added to a differential.
+	// updated is false when the object was deduplicated against an existing hash.
+	ObserveAdd(name string, updated bool)
+
+	// ObserveApply is called once for every call to Each with the number of changes applied
+	// and the time taken to apply them.
+	ObserveApply(name string, applied int, elapsed time.Duration)
+
+	// ObserveError is called when an error occurs adding or applying a change.
+	ObserveError(name string, err error)
+}
+
+// A TxStatsObserver is an Observer that also receives the BoltDB transaction statistics
+// of each Add, AddBatch, AddStream and Each transaction, such as the number of pages allocated and nodes split,
+// to help tune bulk loads. Collecting the statistics is opt-in: they are only reported to observers
+// passed to WithObserver that implement TxStatsObserver.
+type TxStatsObserver interface {
+	Observer
+
+	// ObserveTxStats is called after a transaction commits with the name of the operation, such as "add" or "each".
+	ObserveTxStats(name, op string, stats bolt.TxStats)
+}
+
+var _ Observer = nopObserver{}
+
+// nopObserver is the default observer that discards all events
+type nopObserver struct{}
+
+func (nopObserver) ObserveAdd(string, bool)                 {}
+func (nopObserver) ObserveApply(string, int, time.Duration) {}
+func (nopObserver) ObserveError(string, error)              {}
+
+// observeTxStats reports the statistics of tx to the differential's observer once tx commits,
+// if the observer implements TxStatsObserver.
+func (diff *Differential) observeTxStats(tx *bolt.Tx, op string) {
+	o, ok := diff.observer.(TxStatsObserver)
+	if !ok {
+		return
+	}
+	tx.OnCommit(func() {
+		o.ObserveTxStats(diff.Name(), op, tx.Stats())
+	})
+}
@@ -0,0 +1,146 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/boltdb/bolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type countingObserver struct {
+	adds, dedups, applied, errors int
+}
+
+func (o *countingObserver) ObserveAdd(name string, updated bool) {
+	if updated {
+		o.adds++
+	} else {
+		o.dedups++
+	}
+}
+
+func (o *countingObserver) ObserveApply(name string, applied int, elapsed time.Duration) {
+	o.applied += applied
+}
+
+func (o *countingObserver) ObserveError(name string, err error) {
+	o.errors++
+}
+
+func TestWithObserver(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var obs = new(countingObserver)
+	db, err := New(filepath.Join(dir, "state.db"), WithObserver(obs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{"a", "a", "b"} {
+		if _, err := diff.Add(NewIDObject([]byte(v), v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if obs.adds != 2 || obs.dedups != 1 {
+		t.Fatalf("Expected 2 adds and 1 dedup; got %d and %d", obs.adds, obs.dedups)
+	}
+
+	err = diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		if string(id) == "b" {
+			return os.ErrInvalid
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Expected an error from Each")
+	}
+
+	if obs.applied != 1 {
+		t.Fatalf("Expected 1 applied change; got %d", obs.applied)
+	}
+	if obs.errors != 1 {
+		t.Fatalf("Expected 1 observed error; got %d", obs.errors)
+	}
+}
+
+type statsObserver struct {
+	countingObserver
+	ops    []string
+	writes int
+}
+
+func (o *statsObserver) ObserveTxStats(name, op string, stats bolt.TxStats) {
+	o.ops = append(o.ops, op)
+	o.writes += stats.Write
+}
+
+func TestTxStatsObserver(t *testing.T) {
+	obs := new(statsObserver)
+	db, done := openTestDB(t, WithObserver(obs))
+	defer done()
+
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(obs.ops) != 2 || obs.ops[0] != "add" || obs.ops[1] != "each" {
+		t.Fatalf("Expected stats for add and each; got %q", obs.ops)
+	}
+	if obs.writes == 0 {
+		t.Fatal("Expected transaction statistics to be reported")
+	}
+	if stats := db.TxStats(); stats.Write == 0 {
+		t.Fatalf("Expected cumulative write statistics; got %+v", stats)
+	}
+}
+
+func TestDifferential_DedupStats(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_dedup_stats")
+	defer done()
+
+	add := func(id string, v int) {
+		if _, err := diff.Add(NewIDObject([]byte(id), v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	add("a", 1)
+	add("a", 1)
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	add("a", 1)
+	add("b", 2)
+
+	stats := diff.DedupStats(true)
+	if stats != (DedupStats{Adds: 4, Unchanged: 1, PendingHits: 1}) {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	if rate := stats.HitRate(); rate != 0.5 {
+		t.Fatalf("Expected a hit rate of 0.5; got %v", rate)
+	}
+	if stats := diff.DedupStats(false); stats != (DedupStats{}) {
+		t.Fatalf("Expected the stats to be reset; got %+v", stats)
+	}
+}
@@ -0,0 +1,117 @@
+package diffdb
+
+import "github.com/boltdb/bolt"
+
+// An Option configures a DB when it is created with New.
+type Option func(*DB)
+
+// WithObserver registers an Observer to receive instrumentation events
+// from all differentials opened on the database.
+func WithObserver(o Observer) Option {
+	return func(db *DB) {
+		if o == nil {
+			o = nopObserver{}
+		}
+		db.observer = o
+	}
+}
+
+// reserveEntrySize is a rough estimate of the number of bytes used on disk by each tracked entry
+const reserveEntrySize = 256
+
+// WithReserve hints that the database is expected to hold around n entries.
+// BoltDB does not support preallocating buckets, so instead the initial memory map is sized to hold n entries
+// and the file is grown in larger increments.
+// This reduces the number of remaps (which block writers) and file growths during a large import,
+// but the actual size of each entry depends on the size of the IDs and objects stored.
+func WithReserve(n int) Option {
+	return func(db *DB) {
+		size := n * reserveEntrySize
+		if size > db.options.InitialMmapSize {
+			db.options.InitialMmapSize = size
+		}
+		if grow := size / 8; grow > bolt.DefaultAllocSize {
+			db.allocSize = grow
+		}
+	}
+}
+
+// WithTransform registers a function to normalise each object given to Add before it is checked for conflicts,
+// hashed and stored, such as lowercasing an email address or dropping volatile fields.
+// This allows equivalent but differently formatted objects to be treated as unchanged.
+// If the transformed value implements Object then its ID is used and it is given to the conflict key function,
+// otherwise the ID of the original object is used.
+func WithTransform(f func(interface{}) (interface{}, error)) Option {
+	return func(db *DB) {
+		db.transform = f
+	}
+}
+
+// WithoutDedup disables change detection so that every call to Add stages a pending change,
+// even if the object is identical to its committed or pending version.
+// Pending changes are still keyed by ID so only the latest change to an ID is applied,
+// turning the differential into a durable change queue.
+// Hashes are still computed and committed by Each so that change detection works if dedup is re-enabled.
+func WithoutDedup() Option {
+	return func(db *DB) {
+		db.noDedup = true
+	}
+}
+
+// WithAllocSize sets the number of bytes the database file is grown by when it runs out of space.
+// Larger values reduce the number of file growths and remaps during bulk loads at the cost of a larger file on disk.
+// The default is 16MiB.
+//
+// BoltDB manages its freelist internally and does not support configuring its type;
+// growing the file in larger increments is the main lever available to reduce write amplification.
+func WithAllocSize(n int) Option {
+	return func(db *DB) {
+		db.allocSize = n
+	}
+}
+
+// WithNoSync skips fsync after each commit.
+// This greatly improves write throughput for bulk loads but committed changes may be lost,
+// or the database corrupted, if the operating system crashes. It should only be used for data that can be rebuilt.
+func WithNoSync() Option {
+	return func(db *DB) {
+		db.noSync = true
+	}
+}
+
+// WithNoGrowSync skips fsync when the database file is grown.
+// This is safe on filesystems such as ext3/ext4 but may not be on others.
+func WithNoGrowSync() Option {
+	return func(db *DB) {
+		db.options.NoGrowSync = true
+	}
+}
+
+// WithMaxObjectSize limits the size of the encoded payload of each object given to Add to n bytes.
+// Adding a larger object returns an error wrapping ErrObjectTooLarge.
+// This guards against accidentally staging very large objects when ingesting untrusted data.
+func WithMaxObjectSize(n int) Option {
+	return func(db *DB) {
+		db.maxSize = n
+	}
+}
+
+// WithRetainCommitted keeps the payload of each change after it is applied by Each
+// so that committed objects can be migrated in place with MapCommitted.
+// This roughly doubles the space used by the database as every tracked object is stored in full.
+func WithRetainCommitted() Option {
+	return func(db *DB) {
+		db.retain = true
+	}
+}
+
+// WithValidator registers a function to validate each pending change before it is given to the function passed to Each.
+// A change that fails validation is not applied: the error is reported by Each and the change is marked as failed,
+// so it can be retried with EachFailed once the cause has been fixed.
+// Returning ErrSkip leaves the change pending without reporting an error.
+// This centralises defensive checks so that malformed changes are never applied downstream.
+func WithValidator(f func(id []byte, d Decoder) error) Option {
+	return func(db *DB) {
+		db.validator = f
+	}
+}
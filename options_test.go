@@ -0,0 +1,133 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithReserve(t *testing.T) {
+	var db DB
+	WithReserve(1000000)(&db)
+	if db.options.InitialMmapSize != 1000000*reserveEntrySize {
+		t.Fatalf("Unexpected initial mmap size %d", db.options.InitialMmapSize)
+	}
+	if db.allocSize != 1000000*reserveEntrySize/8 {
+		t.Fatalf("Unexpected alloc size %d", db.allocSize)
+	}
+
+	diff, done := openTestDifferential(t, "test_reserve", WithReserve(1000))
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithoutDedup(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_without_dedup", WithoutDedup())
+	defer done()
+
+	for i := 0; i < 2; i++ {
+		updated, err := diff.Add(NewIDObject([]byte("a"), 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !updated {
+			t.Fatalf("Expected add %d to stage a change", i)
+		}
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil || !updated {
+		t.Fatalf("Expected committed object to be staged again; got %v %v", updated, err)
+	}
+
+	changed, err := diff.Changed([]byte("a"), NewIDObject([]byte("a"), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Fatal("Expected committed hash to be recorded")
+	}
+}
+
+func TestWithTuning(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_tuning", WithAllocSize(1<<20), WithNoSync(), WithNoGrowSync())
+	defer done()
+
+	if diff.db.AllocSize != 1<<20 {
+		t.Fatalf("Expected alloc size %d; got %d", 1<<20, diff.db.AllocSize)
+	}
+	if !diff.db.NoSync || !diff.db.NoGrowSync {
+		t.Fatal("Expected NoSync and NoGrowSync to be set")
+	}
+}
+
+func TestWithMaxObjectSize(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_max_object_size", WithMaxObjectSize(16))
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("small"), "a")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := diff.Add(NewIDObject([]byte("large"), strings.Repeat("a", 32)))
+	if !errors.Is(err, ErrObjectTooLarge) {
+		t.Fatalf("Expected %q; got %v", ErrObjectTooLarge, err)
+	}
+	if !strings.Contains(err.Error(), "6c61726765") {
+		t.Fatalf("Expected error to include the object ID; got %q", err)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+}
+
+func TestWithValidator(t *testing.T) {
+	invalid := errors.New("invalid")
+	diff, done := openTestDifferential(t, "test", WithValidator(func(id []byte, d Decoder) error {
+		var obj struct {
+			Object int
+		}
+		if err := d.Decode(&obj); err != nil {
+			return err
+		}
+		if obj.Object < 0 {
+			return invalid
+		}
+		return nil
+	}))
+	defer done()
+
+	for _, obj := range []Object{NewIDObject([]byte("a"), 1), NewIDObject([]byte("b"), -1)} {
+		if _, err := diff.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var applied []string
+	err := diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		applied = append(applied, string(id))
+		return nil
+	})
+	if !errors.Is(err, invalid) {
+		t.Fatalf("Expected %q; got %v", invalid, err)
+	}
+	if len(applied) != 1 || applied[0] != "a" {
+		t.Fatalf("Expected only a to be applied; got %q", applied)
+	}
+
+	failed, err := diff.Failed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || string(failed[0]) != "b" {
+		t.Fatalf("Expected b to be marked as failed; got %q", failed)
+	}
+}
@@ -0,0 +1,47 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/hashicorp/go-multierror"
+)
+
+// ChangeError is the error that caused a single pending change to fail to apply.
+type ChangeError struct {
+	// ID is the ID of the change.
+	ID []byte
+	// Err is the error returned by the validator or apply function.
+	Err error
+}
+
+// EachOutcome details which changes were applied and which failed during a call to EachWithOutcome.
+type EachOutcome struct {
+	// Applied are the IDs of the changes that were applied and committed, in the order they were applied.
+	Applied [][]byte
+	// Failed are the changes that failed to apply and remain pending, marked as failed.
+	Failed []ChangeError
+}
+
+// ErrorOrNil returns the errors of the failed changes as a multierror, or nil if no change failed.
+func (o EachOutcome) ErrorOrNil() error {
+	var err *multierror.Error
+	for _, f := range o.Failed {
+		err = multierror.Append(err, f.Err)
+	}
+	return err.ErrorOrNil()
+}
+
+// EachWithOutcome is like Each but also returns the outcome of each change,
+// so that partial success can be inspected without parsing the returned multierror.
+// Skipped changes appear in neither list of the outcome, and cancellation of ctx is only reported in the returned error.
+// The returned error is the same as would be returned by Each;
+// if it is caused by the database rather than by a change, nothing was committed and the outcome is empty.
+func (diff *Differential) EachWithOutcome(ctx context.Context, f ApplyFunc) (EachOutcome, error) {
+	var out EachOutcome
+	err := diff.eachOutcome(ctx, f.apply, -1, openPendingCursor, &out)
+	if err != nil {
+		if _, ok := err.(*multierror.Error); !ok {
+			return EachOutcome{}, err
+		}
+	}
+	return out, err
+}
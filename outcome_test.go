@@ -0,0 +1,53 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"github.com/hashicorp/go-multierror"
+	"strconv"
+	"testing"
+)
+
+func TestDifferential_EachWithOutcome(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_with_outcome")
+	defer done()
+
+	for i := 0; i < 5; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var errOdd = errors.New("odd")
+	out, err := diff.EachWithOutcome(context.Background(), func(id []byte, data Decoder) error {
+		switch string(id) {
+		case "1", "3":
+			return errOdd
+		case "4":
+			return ErrSkip
+		}
+		return nil
+	})
+	merr, ok := err.(*multierror.Error)
+	if !ok || len(merr.Errors) != 2 {
+		t.Fatalf("Expected a multierror of 2 errors; got %v", err)
+	}
+
+	if len(out.Applied) != 2 || string(out.Applied[0]) != "0" || string(out.Applied[1]) != "2" {
+		t.Fatalf("Expected applied IDs [0 2]; got %q", out.Applied)
+	}
+	if len(out.Failed) != 2 || string(out.Failed[0].ID) != "1" || string(out.Failed[1].ID) != "3" {
+		t.Fatalf("Expected failed IDs [1 3]; got %+v", out.Failed)
+	}
+	for _, f := range out.Failed {
+		if f.Err != errOdd {
+			t.Fatalf("Expected %q for id %s; got %v", errOdd, f.ID, f.Err)
+		}
+	}
+	if out.ErrorOrNil() == nil {
+		t.Fatal("Expected the outcome to report an error")
+	}
+	if pending := diff.CountChanges(); pending != 3 {
+		t.Fatalf("Expected 3 pending changes; got %d", pending)
+	}
+}
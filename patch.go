@@ -0,0 +1,87 @@
+package diffdb
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// AddPatch stages the result of applying patch to the latest version of id,
+// so that sources emitting partial updates do not need to fetch the full object to change some of its fields.
+// The latest version is the pending change of id if there is one, otherwise its committed version;
+// while the differential is paused with Pause, the object held for id takes precedence over both.
+//
+// Patches are merged shallowly: each key of patch replaces the top-level field of the same name,
+// so a nested map or struct in patch replaces the whole nested value rather than being merged into it,
+// and a key with a nil value removes the field. If id has no pending or committed version then
+// the patch itself, without its nil values, is staged as a new object.
+//
+// The latest version is decoded into a map[string]interface{}, which requires it to be encoded as a map
+// such as by the msgpack encoding of a struct, and the merged map is staged in its place.
+// The hash of a map differs from the hash of a struct with the same fields, so a differential
+// should be kept up to date with either AddPatch or Add of maps rather than mixing AddPatch with Add of structs.
+//
+// Committed versions are only available for objects applied with WithRetainCommitted;
+// patching an ID with a committed hash but no retained payload returns an error wrapping ErrNotRetained,
+// and patching an ID deleted with Remove returns an error wrapping ErrDeleted.
+func (diff *Differential) AddPatch(id []byte, patch map[string]interface{}) error {
+	if err := diff.ops.begin(); err != nil {
+		return err
+	}
+	defer diff.ops.end()
+
+	return diff.update(func(tx *bolt.Tx) error {
+		merged, err := diff.latestMap(tx.Bucket(diff.q), id)
+		if err != nil {
+			return err
+		}
+		for k, v := range patch {
+			if v == nil {
+				delete(merged, k)
+				continue
+			}
+			merged[k] = v
+		}
+
+		_, _, err = diff.stage(tx, id, merged, nil, nil)
+		return err
+	})
+}
+
+// latestMap decodes the latest version of id in b into a map: the object held for it while paused,
+// its pending change or otherwise its committed version. An empty map is returned if id has none of them.
+func (diff *Differential) latestMap(b *bolt.Bucket, id []byte) (map[string]interface{}, error) {
+	var (
+		data []byte
+		held []byte
+	)
+	if bhd := b.Bucket(bucketHeld); bhd != nil && isPaused(b) {
+		held = bhd.Get(id)
+	}
+	if held != nil {
+		_, data = splitHeld(held)
+	} else if hash := b.Bucket(bucketPendingHashes).Get(id); hash != nil {
+		data = payloadsOf(b).Get(hash)
+		if data == nil {
+			return nil, errors.Wrapf(ErrMissingHashData, "diffdb: AddPatch: id %x", id)
+		}
+	} else if committed := b.Bucket(bucketHashes).Get(id); isTombstone(committed) {
+		return nil, deletedError(id)
+	} else if committed != nil {
+		if bcd := b.Bucket(bucketCommittedData); bcd != nil {
+			data = bcd.Get(id)
+		}
+		if data == nil {
+			return nil, errors.Wrapf(ErrNotRetained, "diffdb: AddPatch: id %x", id)
+		}
+	}
+
+	m := make(map[string]interface{})
+	if data == nil {
+		return m, nil
+	}
+	d := msgpackDecoder{data: data}
+	if err := d.Decode(&m); err != nil {
+		return nil, errors.Wrapf(err, "diffdb: AddPatch: decode latest version of id %x", id)
+	}
+	return m, nil
+}
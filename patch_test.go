@@ -0,0 +1,106 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDifferential_AddPatch(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_patch", WithRetainCommitted())
+	defer done()
+
+	id := []byte("a")
+	latest := func() map[string]interface{} {
+		var m map[string]interface{}
+		err := diff.Each(context.Background(), func(_ []byte, data Decoder) error {
+			return data.Decode(&m)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	// Without a prior version the patch is the object
+	if err := diff.AddPatch(id, map[string]interface{}{"Name": "a", "Email": "a@example.com", "Age": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if m := latest(); len(m) != 2 || m["Name"] != "a" {
+		t.Fatalf("Expected the patch to be staged; got %v", m)
+	}
+
+	// Patches are applied over the committed version, then over the pending change
+	if err := diff.AddPatch(id, map[string]interface{}{"Email": "b@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.AddPatch(id, map[string]interface{}{"Name": nil, "Age": 42}); err != nil {
+		t.Fatal(err)
+	}
+	m := latest()
+	if _, ok := m["Name"]; ok || len(m) != 2 || m["Email"] != "b@example.com" || fmt.Sprint(m["Age"]) != "42" {
+		t.Fatalf("Expected the patches to be merged; got %v", m)
+	}
+
+	// An empty patch leaves the object unchanged
+	if err := diff.AddPatch(id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected an empty patch not to stage a change; got %d pending", pending)
+	}
+}
+
+func TestDifferential_AddPatch_NotRetained(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_patch_not_retained")
+	defer done()
+
+	if _, err := diff.Add(emailObject{Id: "a", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.AddPatch([]byte("a"), map[string]interface{}{"Email": "b@example.com"}); !errors.Is(err, ErrNotRetained) {
+		t.Fatalf("Expected %q; got %v", ErrNotRetained, err)
+	}
+	if err := diff.Remove([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.AddPatch([]byte("a"), map[string]interface{}{"Email": "b@example.com"}); !errors.Is(err, ErrDeleted) {
+		t.Fatalf("Expected %q; got %v", ErrDeleted, err)
+	}
+}
+
+func TestDifferential_AddPatch_Paused(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_patch_paused")
+	defer done()
+
+	id := []byte("a")
+	if err := diff.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second patch is applied over the object held for the first
+	if err := diff.AddPatch(id, map[string]interface{}{"Name": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.AddPatch(id, map[string]interface{}{"Email": "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]interface{}
+	err := diff.Each(context.Background(), func(_ []byte, data Decoder) error {
+		return data.Decode(&m)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 || m["Name"] != "a" || m["Email"] != "a@example.com" {
+		t.Fatalf("Expected both held patches to be merged; got %v", m)
+	}
+}
@@ -0,0 +1,127 @@
+package diffdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/boltdb/bolt"
+)
+
+var keyPaused = []byte("paused")
+
+// Pause stops tracking changes to the differential until Resume is called, such as during a bulk migration.
+// The paused state is persisted, so the differential remains paused when it is next opened.
+//
+// While paused, objects given to Add and the other staging methods are hashed, encoded and checked
+// for conflicts, tombstones and expected hashes as usual, but are held aside instead of becoming pending changes.
+// Add reports them as not updated, Each does not see them and CountChanges does not count them.
+// Only the latest held object of each ID is kept. Changes that were already pending are unaffected
+// and can still be applied with Each.
+func (diff *Differential) Pause() error {
+	return diff.updateOp(func(tx *bolt.Tx) error {
+		return tx.Bucket(diff.q).Bucket(bucketDiffMeta).Put(keyPaused, []byte{1})
+	})
+}
+
+// Paused returns true if the differential has been paused with Pause.
+func (diff *Differential) Paused() (paused bool, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		paused = isPaused(tx.Bucket(diff.q))
+		return nil
+	})
+	return
+}
+
+// Resume resumes tracking changes to a differential paused with Pause,
+// moving the objects held while paused into the pending changes in a single transaction.
+// Each held object is compared with the committed and pending hashes of its ID at the time Resume is called,
+// so objects that are unchanged are discarded as they would be by Add.
+// Objects of IDs deleted with Remove while paused are discarded, and version fields set by WithVersionField
+// are not checked for held objects. It returns the number of held objects that became pending changes.
+// Resuming a differential that is not paused has no effect.
+func (diff *Differential) Resume() (flushed int, err error) {
+	err = diff.updateOp(func(tx *bolt.Tx) error {
+		flushed = 0
+		b := tx.Bucket(diff.q)
+		if err := b.Bucket(bucketDiffMeta).Delete(keyPaused); err != nil {
+			return err
+		}
+
+		bhd := b.Bucket(bucketHeld)
+		if bhd == nil {
+			return nil
+		}
+		var (
+			bh   = b.Bucket(bucketHashes)
+			bph  = b.Bucket(bucketPendingHashes)
+			bphd = payloadsOf(b)
+		)
+		err := bhd.ForEach(func(id, v []byte) error {
+			hash, raw := splitHeld(v)
+
+			existing := bh.Get(id)
+			if isTombstone(existing) || bytes.Equal(existing, hash) && !diff.noDedup {
+				return nil
+			}
+			if pending := bph.Get(id); pending != nil {
+				if bytes.Equal(pending, hash) && !diff.noDedup {
+					return nil
+				}
+				if err := bphd.Delete(pending); err != nil {
+					return err
+				}
+			}
+
+			// Held values are copied as the held bucket is deleted in the same transaction
+			id, hash = append([]byte(nil), id...), append([]byte(nil), hash...)
+			if err := bph.Put(id, hash); err != nil {
+				return err
+			}
+			if err := bphd.Put(hash, append([]byte(nil), raw...)); err != nil {
+				return err
+			}
+			if diff.sequence {
+				if err := assignSequence(b, id); err != nil {
+					return err
+				}
+			}
+			flushed++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return b.DeleteBucket(bucketHeld)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
+
+// isPaused reports whether the differential bucket b has been paused.
+func isPaused(b *bolt.Bucket) bool {
+	return b.Bucket(bucketDiffMeta).Get(keyPaused) != nil
+}
+
+// holdChange holds the hash and payload of a change to id in b until the differential is resumed.
+// Held values are the length of the hash as a uvarint, the hash and the payload.
+func holdChange(b *bolt.Bucket, id, hash, raw []byte) error {
+	bhd, err := b.CreateBucketIfNotExists(bucketHeld)
+	if err != nil {
+		return err
+	}
+
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(hash)))
+	v := make([]byte, 0, n+len(hash)+len(raw))
+	v = append(v, prefix[:n]...)
+	v = append(v, hash...)
+	return bhd.Put(id, append(v, raw...))
+}
+
+// splitHeld splits a value stored by holdChange into its hash and payload.
+func splitHeld(v []byte) (hash, raw []byte) {
+	n, read := binary.Uvarint(v)
+	v = v[read:]
+	return v[:n], v[n:]
+}
@@ -0,0 +1,74 @@
+package diffdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDifferential_Pause(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_pause")
+	defer done()
+
+	add := func(id string, x interface{}) bool {
+		updated, err := diff.Add(NewIDObject([]byte(id), x))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return updated
+	}
+
+	add("a", 1)
+	add("b", 2)
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := diff.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if paused, err := diff.Paused(); err != nil || !paused {
+		t.Fatalf("Expected the differential to be paused; got %v %v", paused, err)
+	}
+
+	// Held changes are not pending, and only the latest change to each ID is kept
+	if add("a", 10) || add("a", 11) || add("b", 2) || add("c", 3) || add("d", 4) {
+		t.Fatal("Expected Add to report no updates while paused")
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected no pending changes while paused; got %d", pending)
+	}
+	if err := diff.Remove([]byte("d")); err != nil {
+		t.Fatal(err)
+	}
+
+	flushed, err := diff.Resume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flushed != 2 {
+		t.Fatalf("Expected 2 held changes to become pending; got %d", flushed)
+	}
+	if paused, err := diff.Paused(); err != nil || paused {
+		t.Fatalf("Expected the differential to be resumed; got %v %v", paused, err)
+	}
+
+	applied := make(map[string]int)
+	err = diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		var o struct{ Object int }
+		if err := data.Decode(&o); err != nil {
+			return err
+		}
+		applied[string(id)] = o.Object
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || applied["a"] != 11 || applied["c"] != 3 {
+		t.Fatalf("Expected the latest held changes to a and c; got %v", applied)
+	}
+
+	if !add("e", 5) {
+		t.Fatal("Expected Add to stage changes once resumed")
+	}
+}
@@ -0,0 +1,149 @@
+package diffdb
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// Pending decodes the pending change of id into x without applying it.
+// found is false if id has no pending change, in which case x is not modified.
+func (diff *Differential) Pending(id []byte, x interface{}) (found bool, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diff.q)
+		hash := b.Bucket(bucketPendingHashes).Get(id)
+		if hash == nil {
+			return nil
+		}
+
+		found = true
+		data := payloadsOf(b).Get(hash)
+		if data == nil {
+			return errors.Wrapf(ErrMissingHashData, "diffdb: Pending: id %x", id)
+		}
+		d := msgpackDecoder{data: data}
+		return d.Decode(x)
+	})
+	return
+}
+
+// PendingIDs returns the IDs of all pending changes without reading their payloads.
+// Use EachPendingID to avoid holding every ID in memory.
+func (diff *Differential) PendingIDs() (ids [][]byte, err error) {
+	err = diff.EachPendingID(func(id []byte) error {
+		ids = append(ids, append([]byte(nil), id...))
+		return nil
+	})
+	return
+}
+
+// EachPendingID calls f with the ID of each pending change in ID order without reading its payload.
+// The ID given to f is only valid for the duration of the call.
+// If f returns an error then iteration stops and that error is returned.
+func (diff *Differential) EachPendingID(f func(id []byte) error) error {
+	return diff.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(diff.q).Bucket(bucketPendingHashes).Cursor()
+		for id, _ := c.First(); id != nil; id, _ = c.Next() {
+			if err := f(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TruncatePending discards every pending change and failed marker by dropping and recreating their buckets,
+// which is much faster than removing changes one at a time when there are many of them.
+// The sequence numbers and pending versions of the discarded changes are removed individually.
+// Committed hashes are left unchanged, as are the pending changes and failed markers of IDs pinned with Pin.
+func (diff *Differential) TruncatePending() error {
+	return diff.updateOp(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diff.q)
+		kept, err := pinnedPending(b)
+		if err != nil {
+			return err
+		}
+		if err := releaseShared(b); err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{bucketPendingHashes, bucketPendingHashData, bucketFailed} {
+			if err := b.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := b.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+
+		var (
+			bph  = b.Bucket(bucketPendingHashes)
+			bphd = payloadsOf(b)
+			bfl  = b.Bucket(bucketFailed)
+		)
+		for _, p := range kept {
+			if p.hash != nil {
+				if err := bphd.Put(p.hash, p.data); err != nil {
+					return err
+				}
+				if err := bph.Put(p.id, p.hash); err != nil {
+					return err
+				}
+			}
+			if p.failed != nil {
+				if err := bfl.Put(p.id, p.failed); err != nil {
+					return err
+				}
+			}
+		}
+
+		if bsi := b.Bucket(bucketSequenceIDs); bsi != nil {
+			for _, id := range unpinned(b, keysWithPrefix(bsi, nil)) {
+				if err := releaseSequence(b, id); err != nil {
+					return err
+				}
+			}
+		}
+		if bpv := b.Bucket(bucketPendingVersions); bpv != nil {
+			for _, id := range unpinned(b, keysWithPrefix(bpv, nil)) {
+				if err := bpv.Delete(id); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// keptPending is the pending state of a single ID copied out of a differential bucket.
+type keptPending struct {
+	id, hash, data, failed []byte
+}
+
+// pinnedPending copies the pending change and failed marker of each pinned ID in the differential bucket b
+// so that they can be restored after the pending buckets are truncated.
+func pinnedPending(b *bolt.Bucket) (kept []keptPending, err error) {
+	bp := b.Bucket(bucketPinned)
+	if bp == nil {
+		return nil, nil
+	}
+	var (
+		bph  = b.Bucket(bucketPendingHashes)
+		bphd = payloadsOf(b)
+		bfl  = b.Bucket(bucketFailed)
+	)
+	err = bp.ForEach(func(id, _ []byte) error {
+		p := keptPending{id: append([]byte(nil), id...)}
+		if hash := bph.Get(id); hash != nil {
+			p.hash = append([]byte(nil), hash...)
+			p.data = append([]byte(nil), bphd.Get(hash)...)
+		}
+		if failed := bfl.Get(id); failed != nil {
+			p.failed = append([]byte(nil), failed...)
+		}
+		if p.hash != nil || p.failed != nil {
+			kept = append(kept, p)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,112 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/boltdb/bolt"
+	"strconv"
+	"testing"
+)
+
+func TestDifferential_Pending(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_pending")
+	defer done()
+
+	if _, err := diff.Add(emailObject{Id: "1", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var o emailObject
+	found, err := diff.Pending([]byte("1"), &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || o.Email != "a@example.com" {
+		t.Fatalf("Expected pending change to be found; got %v %+v", found, o)
+	}
+
+	found, err = diff.Pending([]byte("2"), &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Fatal("Expected no pending change")
+	}
+}
+
+func TestDifferential_PendingIDs(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_pending_ids")
+	defer done()
+
+	for _, id := range []string{"b", "a", "c"} {
+		if _, err := diff.Add(NewIDObject([]byte(id), id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, err := diff.PendingIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || string(ids[0]) != "a" || string(ids[1]) != "b" || string(ids[2]) != "c" {
+		t.Fatalf("Unexpected pending IDs %q", ids)
+	}
+}
+
+func TestDifferential_TruncatePending(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := diff.TruncatePending(); err != nil {
+		t.Fatal(err)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected no pending changes; got %d", pending)
+	}
+	if tracking := diff.CountTracking(); tracking != 1 {
+		t.Fatalf("Expected 1 tracked ID; got %d", tracking)
+	}
+}
+
+func TestDifferential_TruncatePending_Sequence(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_truncate_sequence", WithSequenceNumbers(), WithVersionField("Version"))
+	defer done()
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := diff.Add(versionedObject{Key: key, Version: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Pin([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.TruncatePending(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := diff.ViewUserDataTx(func(tx *bolt.Tx, _ *bolt.Bucket) error {
+		b := tx.Bucket(diff.q)
+		if n := b.Bucket(bucketSequence).Stats().KeyN; n != 1 {
+			t.Errorf("Expected only the sequence number of pinned a to remain; got %d sequence numbers", n)
+		}
+		bpv := b.Bucket(bucketPendingVersions)
+		if bpv.Get([]byte("a")) == nil || bpv.Get([]byte("b")) != nil {
+			t.Error("Expected only the pending version of pinned a to remain")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
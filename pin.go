@@ -0,0 +1,91 @@
+package diffdb
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// ErrPinned indicates that an ID given to Remove has been pinned with Pin.
+var ErrPinned = errors.New("diffdb: object is pinned")
+
+// Pin marks id as pinned, indicating that it is managed outside of the normal synchronisation,
+// such as a manually created record, and should never be treated as deleted when it is missing from a source.
+// This package does not detect deletions itself; callers that do should skip IDs for which IsPinned returns true.
+// Pinned IDs are protected from the deletion paths of this package: Remove returns an error wrapping ErrPinned,
+// and ForgetBatch, ForgetPrefix and TruncatePending leave their state untouched.
+// Pins are kept by Reset. Pinning an ID that is already pinned has no effect.
+func (diff *Differential) Pin(id []byte) error {
+	if len(id) == 0 {
+		return ErrEmptyID
+	}
+	return diff.updateOp(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(diff.q).CreateBucketIfNotExists(bucketPinned)
+		if err != nil {
+			return err
+		}
+		return b.Put(id, nil)
+	})
+}
+
+// Unpin removes the pin from id. Unpinning an ID that is not pinned has no effect.
+func (diff *Differential) Unpin(id []byte) error {
+	return diff.updateOp(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diff.q).Bucket(bucketPinned)
+		if b == nil {
+			return nil
+		}
+		return b.Delete(id)
+	})
+}
+
+// IsPinned returns true if id has been pinned with Pin.
+func (diff *Differential) IsPinned(id []byte) (pinned bool, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(diff.q).Bucket(bucketPinned); b != nil {
+			pinned = b.Get(id) != nil
+		}
+		return nil
+	})
+	return
+}
+
+// PinnedIDs returns every pinned ID in ID order.
+func (diff *Differential) PinnedIDs() (ids [][]byte, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diff.q).Bucket(bucketPinned)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(id, _ []byte) error {
+			ids = append(ids, append([]byte(nil), id...))
+			return nil
+		})
+	})
+	return
+}
+
+// isPinned reports whether id is pinned in the differential bucket b.
+func isPinned(b *bolt.Bucket, id []byte) bool {
+	bp := b.Bucket(bucketPinned)
+	return bp != nil && bp.Get(id) != nil
+}
+
+// unpinned returns the keys that are not pinned in the differential bucket b, preserving their order.
+func unpinned(b *bolt.Bucket, keys [][]byte) [][]byte {
+	bp := b.Bucket(bucketPinned)
+	if bp == nil {
+		return keys
+	}
+	var kept [][]byte
+	for _, k := range keys {
+		if bp.Get(k) == nil {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
+
+// pinnedError returns an error wrapping ErrPinned for id.
+func pinnedError(id []byte) error {
+	return errors.Wrapf(ErrPinned, "diffdb: id %x", id)
+}
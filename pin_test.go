@@ -0,0 +1,159 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDifferential_Pin(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	for _, id := range []string{"b", "a"} {
+		if err := diff.Pin([]byte(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Unpin([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Unpin([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := diff.PinnedIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || string(ids[0]) != "a" {
+		t.Fatalf("Expected only a to be pinned; got %q", ids)
+	}
+
+	for id, expect := range map[string]bool{"a": true, "b": false} {
+		pinned, err := diff.IsPinned([]byte(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pinned != expect {
+			t.Fatalf("Expected %s pinned to be %t; got %t", id, expect, pinned)
+		}
+	}
+
+	// Pins survive a reset
+	if err := diff.Reset(false); err != nil {
+		t.Fatal(err)
+	}
+	if pinned, err := diff.IsPinned([]byte("a")); err != nil || !pinned {
+		t.Fatalf("Expected a to remain pinned after Reset; got %t, %v", pinned, err)
+	}
+}
+
+// pinTestDifferential opens a differential with a committed and a pending change for each of a and b, and pins a.
+func pinTestDifferential(t *testing.T) (*Differential, func()) {
+	diff, done := openTestDifferential(t, "test")
+	for i, id := range []string{"a", "b"} {
+		if _, err := diff.Add(NewIDObject([]byte(id), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"a", "b"} {
+		if _, err := diff.Add(NewIDObject([]byte(id), i+10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Pin([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	return diff, done
+}
+
+func TestDifferential_Pin_Remove(t *testing.T) {
+	diff, done := pinTestDifferential(t)
+	defer done()
+
+	if err := diff.Remove([]byte("a")); !errors.Is(err, ErrPinned) {
+		t.Fatalf("Expected ErrPinned; got %v", err)
+	}
+	if deleted, err := diff.IsDeleted([]byte("a")); err != nil || deleted {
+		t.Fatalf("Expected a not to be deleted; got %t, %v", deleted, err)
+	}
+	if pending := diff.CountChanges(); pending != 2 {
+		t.Fatalf("Expected the pending change of a to be kept; got %d pending", pending)
+	}
+	if err := diff.Remove([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDifferential_Pin_ForgetBatch(t *testing.T) {
+	diff, done := pinTestDifferential(t)
+	defer done()
+
+	removed, err := diff.ForgetBatch([][]byte{[]byte("a"), []byte("b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("Expected only b to be removed; got %d", removed)
+	}
+	if tracking := diff.CountTracking(); tracking != 1 {
+		t.Fatalf("Expected a to remain tracked; got %d", tracking)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected the pending change of a to be kept; got %d pending", pending)
+	}
+}
+
+func TestDifferential_Pin_ForgetPrefix(t *testing.T) {
+	diff, done := pinTestDifferential(t)
+	defer done()
+
+	removed, err := diff.ForgetPrefix(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("Expected only b to be removed; got %d", removed)
+	}
+	if tracking := diff.CountTracking(); tracking != 1 {
+		t.Fatalf("Expected a to remain tracked; got %d", tracking)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected the pending change of a to be kept; got %d pending", pending)
+	}
+}
+
+func TestDifferential_Pin_TruncatePending(t *testing.T) {
+	diff, done := pinTestDifferential(t)
+	defer done()
+
+	if err := diff.TruncatePending(); err != nil {
+		t.Fatal(err)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected the pending change of a to be kept; got %d pending", pending)
+	}
+
+	var applied []string
+	err := diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		var o struct{ Object int }
+		if err := data.Decode(&o); err != nil {
+			return err
+		}
+		if o.Object != 10 {
+			t.Fatalf("Expected the kept change of a to decode as 10; got %d", o.Object)
+		}
+		applied = append(applied, string(id))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0] != "a" {
+		t.Fatalf("Expected only a to be applied; got %q", applied)
+	}
+}
@@ -0,0 +1,180 @@
+package diffdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"hash"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// PortableHash is the name of a hash algorithm with a documented, stable encoding.
+// Objects are encoded canonically and hashed with SHA-256, so hashes only depend on the values of the object
+// and are stable across Go versions, architectures and releases of this package.
+// Select it for a differential with Differential.UseHash.
+//
+// The canonical encoding follows the same rules as DefaultHash:
+// only exported struct fields are encoded, fields tagged with `hash:"ignore"` or `hash:"-"` are skipped,
+// pointers and interfaces are encoded as the value they refer to, and map entries are encoded in a sorted order.
+// Integers are encoded as 64 bit big endian values regardless of their size,
+// so changing the size of an integer field does not change the hash.
+// Functions, channels and unsafe pointers cannot be hashed and cause an error wrapping ErrUnhashable.
+const PortableHash = "sha256-canonical"
+
+func init() {
+	RegisterHash(PortableHash, portableHash)
+}
+
+// portableHash hashes the canonical encoding of x with SHA-256.
+func portableHash(x interface{}) ([]byte, error) {
+	h := sha256.New()
+	if err := canonicalEncode(h, reflect.ValueOf(x), "object"); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Each encoded value is prefixed by a tag identifying its kind
+// so that values of different kinds never have the same encoding.
+const (
+	tagNil byte = iota
+	tagBool
+	tagInt
+	tagUint
+	tagFloat
+	tagComplex
+	tagString
+	tagList
+	tagMap
+	tagStruct
+)
+
+// canonicalEncode writes the canonical encoding of v to h.
+// path names v in errors.
+func canonicalEncode(h hash.Hash, v reflect.Value, path string) error {
+	var buf [8]byte
+	writeUint := func(n uint64) {
+		binary.BigEndian.PutUint64(buf[:], n)
+		h.Write(buf[:])
+	}
+	writeBytes := func(b []byte) {
+		writeUint(uint64(len(b)))
+		h.Write(b)
+	}
+
+	if !v.IsValid() {
+		h.Write([]byte{tagNil})
+		return nil
+	}
+	if unhashable(v.Kind()) {
+		return errors.Wrapf(ErrUnhashable, "diffdb: %s has type %s", path, v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			h.Write([]byte{tagNil})
+			return nil
+		}
+		return canonicalEncode(h, v.Elem(), path)
+
+	case reflect.Bool:
+		h.Write([]byte{tagBool})
+		if v.Bool() {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		h.Write([]byte{tagInt})
+		writeUint(uint64(v.Int()))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		h.Write([]byte{tagUint})
+		writeUint(v.Uint())
+
+	case reflect.Float32, reflect.Float64:
+		h.Write([]byte{tagFloat})
+		writeUint(math.Float64bits(v.Float()))
+
+	case reflect.Complex64, reflect.Complex128:
+		h.Write([]byte{tagComplex})
+		c := v.Complex()
+		writeUint(math.Float64bits(real(c)))
+		writeUint(math.Float64bits(imag(c)))
+
+	case reflect.String:
+		h.Write([]byte{tagString})
+		writeBytes([]byte(v.String()))
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			h.Write([]byte{tagNil})
+			return nil
+		}
+		h.Write([]byte{tagList})
+		writeUint(uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := canonicalEncode(h, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if v.IsNil() {
+			h.Write([]byte{tagNil})
+			return nil
+		}
+
+		// Encode each entry separately so that the entries can be sorted by their encoding
+		type entry struct{ key, value []byte }
+		entries := make([]entry, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k, e := sha256.New(), sha256.New()
+			if err := canonicalEncode(k, iter.Key(), path); err != nil {
+				return err
+			}
+			if err := canonicalEncode(e, iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key())); err != nil {
+				return err
+			}
+			entries = append(entries, entry{k.Sum(nil), e.Sum(nil)})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+
+		h.Write([]byte{tagMap})
+		writeUint(uint64(len(entries)))
+		for _, e := range entries {
+			h.Write(e.key)
+			h.Write(e.value)
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		fields := hashedFields(t)
+		sort.Slice(fields, func(i, j int) bool {
+			return t.Field(fields[i]).Name < t.Field(fields[j]).Name
+		})
+
+		h.Write([]byte{tagStruct})
+		writeUint(uint64(len(fields)))
+		for _, i := range fields {
+			name := t.Field(i).Name
+			writeBytes([]byte(name))
+			if err := canonicalEncode(h, v.Field(i), path+"."+name); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return errors.Wrapf(ErrUnhashable, "diffdb: %s has type %s", path, v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package diffdb
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+type portableObject struct {
+	Name    string
+	Count   int32
+	Labels  map[string]string
+	Skipped string `hash:"ignore"`
+	private string
+}
+
+func TestPortableHash(t *testing.T) {
+	hash := func(x interface{}) string {
+		h, err := HashOfWith(PortableHash, x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hex.EncodeToString(h)
+	}
+
+	a := hash(portableObject{Name: "a", Count: 1, Labels: map[string]string{"x": "1", "y": "2"}, Skipped: "a", private: "a"})
+	if b := hash(&portableObject{Name: "a", Count: 1, Labels: map[string]string{"y": "2", "x": "1"}, Skipped: "b", private: "b"}); a != b {
+		t.Fatal("Expected objects differing only by ignored fields to be equal")
+	}
+	if b := hash(portableObject{Name: "a", Count: 2, Labels: map[string]string{"x": "1", "y": "2"}}); a == b {
+		t.Fatal("Expected objects with different counts to differ")
+	}
+
+	// The encoding is fixed, so the hash of a known value must never change
+	if h, expect := hash("abc"), "f6ecdcfb336d741eaebc199d3fa8a8f290b8f984095461ce9ba4038379189af1"; h != expect {
+		t.Fatalf("Expected hash %s; got %s", expect, h)
+	}
+
+	if _, err := HashOfWith(PortableHash, struct{ F func() }{}); !errors.Is(err, ErrUnhashable) {
+		t.Fatalf("Expected %q; got %v", ErrUnhashable, err)
+	}
+}
@@ -0,0 +1,150 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/go-multierror"
+	"sync"
+)
+
+// eachPrefixRound is the maximum number of changes applied by EachPrefix in a single transaction
+// before giving other EachPrefix calls a turn.
+const eachPrefixRound = 256
+
+// EachPrefix is like Each but only applies pending changes whose ID starts with prefix,
+// such as those built with CompositeID for a single tenant.
+//
+// EachPrefix may be called concurrently from multiple goroutines, typically with disjoint prefixes,
+// to apply changes of each namespace in parallel. BoltDB only allows a single writer at a time,
+// so rather than holding the write lock until all of its changes are applied,
+// EachPrefix applies up to 256 changes per transaction and then waits for its next turn.
+// Turns are granted to concurrent EachPrefix calls on the same database in the order they were requested,
+// so the calls interleave fairly and none is blocked until the others have finished.
+// Calls to f from concurrent EachPrefix calls never overlap, so f does not need to be safe for concurrent use
+// unless it is shared with other operations.
+// Other operations such as Add and Each do not take turns and acquire the write lock directly.
+//
+// Because changes are committed in rounds, an error applying one round does not roll back earlier rounds.
+// Errors returned by f are accumulated as in Each. If the context is cancelled then the changes applied so far are committed.
+// Calling EachPrefix concurrently with overlapping prefixes is safe but may apply changes in an unpredictable order.
+func (diff *Differential) EachPrefix(ctx context.Context, prefix []byte, f ApplyFunc) error {
+	var (
+		results *multierror.Error
+		after   []byte
+	)
+
+	for {
+		if err := diff.turns.acquire(ctx); err != nil {
+			return multierror.Append(results, err).ErrorOrNil()
+		}
+
+		var cur *prefixCursor
+		err := diff.each(ctx, f.apply, eachPrefixRound, func(b *bolt.Bucket) (changeCursor, error) {
+			cur = &prefixCursor{c: b.Bucket(bucketPendingHashes).Cursor(), prefix: prefix, after: after}
+			return cur, nil
+		})
+		diff.turns.release()
+
+		merr, ok := err.(*multierror.Error)
+		if err != nil && !ok {
+			return err
+		}
+		if merr != nil {
+			results = multierror.Append(results, merr.Errors...)
+		}
+		if cur.exhausted || ctx.Err() != nil {
+			return results.ErrorOrNil()
+		}
+		after = cur.last
+	}
+}
+
+// prefixCursor is a changeCursor over the pending changes whose ID starts with prefix,
+// starting after the ID after if it is not nil.
+type prefixCursor struct {
+	c      *bolt.Cursor
+	prefix []byte
+	after  []byte
+
+	// last is the last ID yielded by the cursor, and exhausted is true once it has yielded every change
+	last      []byte
+	exhausted bool
+}
+
+func (p *prefixCursor) First() (id []byte, hash []byte) {
+	if p.after == nil {
+		return p.yield(p.c.Seek(p.prefix))
+	}
+	id, hash = p.c.Seek(p.after)
+	if bytes.Equal(id, p.after) {
+		id, hash = p.c.Next()
+	}
+	return p.yield(id, hash)
+}
+
+func (p *prefixCursor) Next() (id []byte, hash []byte) {
+	return p.yield(p.c.Next())
+}
+
+func (p *prefixCursor) yield(id, hash []byte) ([]byte, []byte) {
+	if id == nil || !bytes.HasPrefix(id, p.prefix) {
+		p.exhausted = true
+		return nil, nil
+	}
+	p.last = append(p.last[:0], id...)
+	return id, hash
+}
+
+// turnQueue grants turns to callers in the order they were requested.
+type turnQueue struct {
+	mu      sync.Mutex
+	busy    bool
+	waiting []chan struct{}
+}
+
+// acquire waits for a turn, returning the context error if the context is done first.
+// Every successful call to acquire must be followed by a call to release.
+func (q *turnQueue) acquire(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.busy {
+		q.busy = true
+		q.mu.Unlock()
+		return nil
+	}
+	turn := make(chan struct{})
+	q.waiting = append(q.waiting, turn)
+	q.mu.Unlock()
+
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	for i, w := range q.waiting {
+		if w == turn {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			q.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	q.mu.Unlock()
+
+	// The turn was granted concurrently with cancellation so it must be passed on
+	q.release()
+	return ctx.Err()
+}
+
+// release ends the current turn, granting the next turn to the longest waiting caller.
+func (q *turnQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiting) == 0 {
+		q.busy = false
+		return
+	}
+	close(q.waiting[0])
+	q.waiting = q.waiting[1:]
+}
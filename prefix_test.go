@@ -0,0 +1,113 @@
+package diffdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDifferential_EachPrefix(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_prefix")
+	defer done()
+
+	const n = 2*eachPrefixRound + 1
+	for _, prefix := range []string{"a/", "b/", "c/"} {
+		for i := 0; i < n; i++ {
+			id := fmt.Sprintf("%s%04d", prefix, i)
+			if _, err := diff.Add(NewIDObject([]byte(id), id)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		applied []string
+		wg      sync.WaitGroup
+		queued  sync.Once
+	)
+	for _, prefix := range []string{"a/", "b/"} {
+		prefix := prefix
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := diff.EachPrefix(context.Background(), []byte(prefix), func(id []byte, data Decoder) error {
+				if !strings.HasPrefix(string(id), prefix) {
+					t.Errorf("Expected IDs with prefix %q; got %q", prefix, id)
+				}
+				// Hold the first turn until the other call is waiting for one, so that the calls overlap
+				queued.Do(func() {
+					for {
+						diff.turns.mu.Lock()
+						waiting := len(diff.turns.waiting)
+						diff.turns.mu.Unlock()
+						if waiting > 0 {
+							return
+						}
+						time.Sleep(time.Millisecond)
+					}
+				})
+				mu.Lock()
+				applied = append(applied, prefix)
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(applied) != 2*n {
+		t.Fatalf("Expected %d applied changes; got %d", 2*n, len(applied))
+	}
+	if pending := diff.CountChanges(); pending != n {
+		t.Fatalf("Expected the changes of the other prefix to be left pending; got %d pending", pending)
+	}
+
+	// The calls take turns, so the first call cannot have applied all of its changes before the second started
+	var switches int
+	for i := 1; i < len(applied); i++ {
+		if applied[i] != applied[i-1] {
+			switches++
+		}
+	}
+	if switches < 2 {
+		t.Fatalf("Expected the calls to interleave; got %d switches", switches)
+	}
+}
+
+func TestDifferential_EachPrefix_Failed(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_prefix_failed")
+	defer done()
+
+	const n = eachPrefixRound + 10
+	for i := 0; i < n; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(fmt.Sprintf("a/%04d", i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Failed changes are not revisited in later rounds
+	var calls int
+	err := diff.EachPrefix(context.Background(), []byte("a/"), func(id []byte, data Decoder) error {
+		calls++
+		if calls%2 == 0 {
+			return fmt.Errorf("failed %s", id)
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if calls != n {
+		t.Fatalf("Expected %d calls; got %d", n, calls)
+	}
+	if pending := diff.CountChanges(); pending != n/2 {
+		t.Fatalf("Expected %d pending changes; got %d", n/2, pending)
+	}
+}
@@ -0,0 +1,58 @@
+package diffdb
+
+import (
+	"encoding/binary"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+// keyRuns is the reserved user data key holding the ring buffer of recent runs of Each
+var keyRuns = []byte("_diffdb.runs")
+
+const (
+	// maxRuns is the number of recent runs of Each kept for ChangeRate
+	maxRuns = 64
+	// runSize is the encoded size of each run: the start time in Unix nanoseconds followed by the number of applied changes
+	runSize = 16
+)
+
+// recordRun appends a run of Each that started at start and applied n changes to the ring buffer in the user data bucket,
+// discarding the oldest run once maxRuns are recorded.
+func recordRun(ud *bolt.Bucket, start time.Time, n int) error {
+	runs := ud.Get(keyRuns)
+	if len(runs) >= maxRuns*runSize {
+		runs = runs[len(runs)-(maxRuns-1)*runSize:]
+	}
+
+	v := make([]byte, len(runs)+runSize)
+	copy(v, runs)
+	binary.BigEndian.PutUint64(v[len(runs):], uint64(start.UnixNano()))
+	binary.BigEndian.PutUint64(v[len(runs)+8:], uint64(n))
+	return ud.Put(keyRuns, v)
+}
+
+// ChangeRate returns the average number of changes applied per run of Each over the most recent window runs,
+// which can be used to detect a run with an unusual number of changes.
+// If window is <= 0 or greater than the number of recorded runs then all recorded runs are used.
+// Only the most recent 64 runs are recorded, in a reserved key of the user data bucket.
+// It returns 0 if no runs have been recorded.
+func (diff *Differential) ChangeRate(window int) (avg float64, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(diff.q).Bucket(bucketUserData).Get(keyRuns)
+		n := len(runs) / runSize
+		if n == 0 {
+			return nil
+		}
+		if window <= 0 || window > n {
+			window = n
+		}
+
+		var total uint64
+		for i := n - window; i < n; i++ {
+			total += binary.BigEndian.Uint64(runs[i*runSize+8:])
+		}
+		avg = float64(total) / float64(window)
+		return nil
+	})
+	return
+}
@@ -0,0 +1,58 @@
+package diffdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestDifferential_ChangeRate(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	avg, err := diff.ChangeRate(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avg != 0 {
+		t.Fatalf("Expected no change rate; got %f", avg)
+	}
+
+	// Apply runs of 1, 2 and 6 changes
+	var next int
+	for _, n := range []int{1, 2, 6} {
+		for i := 0; i < n; i++ {
+			next++
+			if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(next)), next)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for window, expect := range map[int]float64{0: 3, 1: 6, 2: 4, 10: 3} {
+		avg, err := diff.ChangeRate(window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if avg != expect {
+			t.Fatalf("Expected change rate %f over %d runs; got %f", expect, window, avg)
+		}
+	}
+
+	// The ring buffer is bounded
+	for i := 0; i < maxRuns*2; i++ {
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	avg, err = diff.ChangeRate(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avg != 0 {
+		t.Fatalf("Expected earlier runs to be discarded; got change rate %f", avg)
+	}
+}
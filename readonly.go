@@ -0,0 +1,107 @@
+package diffdb
+
+import (
+	"errors"
+	"github.com/boltdb/bolt"
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrReadOnly is returned by methods that modify a differential when the database was opened with WithReadOnly.
+	ErrReadOnly = bolt.ErrDatabaseReadOnly
+
+	// ErrLocked indicates that the database file could not be locked within the timeout set by WithLockTimeout
+	// because another process holds a conflicting lock.
+	ErrLocked = errors.New("diffdb: database file is locked by another process")
+
+	// ErrReadOnlyStorage indicates that New could not open the database file for writing
+	// because it is on a read-only filesystem or is not writable by the process.
+	// Use WithReadOnlyFallback to open the database in read-only mode instead.
+	ErrReadOnlyStorage = errors.New("diffdb: database file is on read-only storage")
+)
+
+// WithReadOnly opens the database in read-only mode so that multiple processes can read it at the same time.
+// Open will not create differentials and returns ErrNoDifferential if the differential does not exist,
+// and methods that modify a differential return ErrReadOnly.
+//
+// Read-only mode takes a shared lock on the database file, which cannot be held while another process
+// has the file open for writing (on Linux and Darwin, New blocks until the writer closes the file).
+// Use WithLockTimeout to return ErrLocked instead of waiting indefinitely.
+func WithReadOnly() Option {
+	return func(db *DB) {
+		db.options.ReadOnly = true
+	}
+}
+
+// WithReadOnlyFallback opens the database in read-only mode, as if WithReadOnly was given,
+// if the database file cannot be opened for writing because it is on read-only storage,
+// such as a volume remounted read-only during an incident. Without it New returns ErrReadOnlyStorage.
+// Reads continue to be served while methods that modify a differential return ErrReadOnly;
+// use DB.ReadOnly to check which mode the database was opened in.
+// The database file must already exist to be opened in read-only mode.
+func WithReadOnlyFallback() Option {
+	return func(db *DB) {
+		db.readOnlyFallback = true
+	}
+}
+
+// ReadOnly returns true if the database was opened in read-only mode,
+// either with WithReadOnly or because WithReadOnlyFallback fell back to it.
+func (db *DB) ReadOnly() bool {
+	return db.options.ReadOnly
+}
+
+// isReadOnlyStorage reports whether err from opening the database file for writing
+// was caused by the file being on a read-only filesystem or lacking write permission.
+func isReadOnlyStorage(err error) bool {
+	return errors.Is(err, syscall.EROFS) || errors.Is(err, os.ErrPermission)
+}
+
+// WithLockTimeout sets the maximum amount of time New waits to lock the database file
+// before returning ErrLocked. By default New waits indefinitely.
+func WithLockTimeout(d time.Duration) Option {
+	return func(db *DB) {
+		db.options.Timeout = d
+	}
+}
+
+// differentialBuckets are the buckets every differential must contain to be opened without modifying it
+var differentialBuckets = [][]byte{
+	bucketHashes,
+	bucketPendingHashes,
+	bucketPendingHashData,
+	bucketUserData,
+	bucketFailed,
+	bucketDiffMeta,
+}
+
+// openReadOnly opens an existing differential without modifying the database.
+// A differential last written by an older version of diffdb that lacks any of the current buckets
+// must be opened once by a writer before it can be opened read-only.
+func (db *DB) openReadOnly(q []byte) (*Differential, error) {
+	var diff *Differential
+	err := db.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(q)
+		if b == nil {
+			return ErrNoDifferential
+		}
+		for _, name := range differentialBuckets {
+			if b.Bucket(name) == nil {
+				return ErrNotDiffDB
+			}
+		}
+
+		var err error
+		diff, err = db.newDifferential(q, string(b.Bucket(bucketDiffMeta).Get(keyHashName)))
+		if err != nil {
+			return err
+		}
+		return diff.checkHashLen(b)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
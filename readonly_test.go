@@ -0,0 +1,126 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.db")
+	db, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A writer holds an exclusive lock so a reader must time out
+	if _, err := New(path, WithReadOnly(), WithLockTimeout(10*time.Millisecond)); err != ErrLocked {
+		t.Fatalf("Expected %q; got %v", ErrLocked, err)
+	}
+	db.Close()
+
+	ro, err := New(path, WithReadOnly(), WithLockTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+
+	if _, err := ro.Open("missing"); err != ErrNoDifferential {
+		t.Fatalf("Expected %q; got %v", ErrNoDifferential, err)
+	}
+
+	diff, err = ro.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("b"), 2)); err != ErrReadOnly {
+		t.Fatalf("Expected %q; got %v", ErrReadOnly, err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != ErrReadOnly {
+		t.Fatalf("Expected %q; got %v", ErrReadOnly, err)
+	}
+}
+
+func TestIsReadOnlyStorage(t *testing.T) {
+	if !isReadOnlyStorage(&os.PathError{Op: "open", Path: "state.db", Err: syscall.EROFS}) {
+		t.Fatal("Expected a read-only filesystem to be read-only storage")
+	}
+	if isReadOnlyStorage(&os.PathError{Op: "open", Path: "state.db", Err: syscall.ENOSPC}) {
+		t.Fatal("Expected a full disk not to be read-only storage")
+	}
+}
+
+func TestWithReadOnlyFallback(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.db")
+	db, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if err := os.Chmod(path, 0400); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := os.OpenFile(path, os.O_RDWR, 0); err == nil {
+		f.Close()
+		t.Skip("Database file is still writable, such as when running as root")
+	}
+
+	if _, err := New(path); !errors.Is(err, ErrReadOnlyStorage) {
+		t.Fatalf("Expected %q; got %v", ErrReadOnlyStorage, err)
+	}
+
+	db, err = New(path, WithReadOnlyFallback())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !db.ReadOnly() {
+		t.Fatal("Expected the database to fall back to read-only mode")
+	}
+
+	diff, err = db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("b"), 2)); err != ErrReadOnly {
+		t.Fatalf("Expected %q; got %v", ErrReadOnly, err)
+	}
+}
@@ -0,0 +1,135 @@
+package diffdb
+
+import (
+	"bytes"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// ErrMergeConflict indicates that a backup given to RestoreMerge with MergeError
+// has a different committed hash for an ID than the differential it is merged into.
+var ErrMergeConflict = errors.New("diffdb: conflicting committed hash")
+
+// A MergePolicy decides how RestoreMerge resolves an ID whose committed hash in the backup
+// differs from its committed hash in the differential.
+type MergePolicy int
+
+const (
+	// MergeSkip keeps the committed hash of the differential.
+	MergeSkip MergePolicy = iota
+	// MergeOverwrite replaces the committed hash of the differential with the hash from the backup.
+	MergeOverwrite
+	// MergeError aborts the merge with an error wrapping ErrMergeConflict, leaving the differential unchanged.
+	MergeError
+)
+
+// A MergeSummary reports the outcome of RestoreMerge.
+type MergeSummary struct {
+	// Added is the number of IDs committed in the backup that were not tracked by the differential.
+	Added int
+	// Overwritten is the number of conflicting IDs whose hash was replaced by the backup.
+	Overwritten int
+	// Skipped is the number of conflicting IDs whose hash was kept.
+	Skipped int
+	// Unchanged is the number of IDs with the same committed hash in the backup and the differential.
+	Unchanged int
+}
+
+// RestoreMerge folds the committed hashes of the differential called name in a backup written by Backup
+// into the existing differential of the same name, rather than replacing it, resolving conflicting hashes with policy.
+// This supports incremental backups and partial recovery.
+// Only committed hashes are merged; the pending changes, failed markers and user data of the backup are ignored.
+// When the hash of an ID is replaced, its committed payload retained by WithRetainCommitted and its committed version
+// are discarded, as they describe the object before the merge. A pending change of the ID is kept,
+// and is applied over the merged hash as usual.
+// The merge happens in a single transaction, so if it fails the differential is left unchanged.
+//
+// It returns ErrNoDifferential if either the backup or the database does not contain the differential,
+// and an error if the backup uses a different hash algorithm, as their hashes cannot be compared.
+// The backup is spooled to a temporary file while it is read.
+func (db *DB) RestoreMerge(name string, r io.Reader, policy MergePolicy) (summary MergeSummary, err error) {
+	f, err := ioutil.TempFile("", "diffdb-restore")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+
+	backup, err := bolt.Open(f.Name(), 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return
+	}
+	defer backup.Close()
+
+	q := []byte(name)
+	err = backup.View(func(btx *bolt.Tx) error {
+		from := btx.Bucket(q)
+		if from == nil || from.Bucket(bucketHashes) == nil {
+			return ErrNoDifferential
+		}
+
+		return db.updateOp(func(tx *bolt.Tx) error {
+			to := tx.Bucket(q)
+			if to == nil || to.Bucket(bucketHashes) == nil {
+				return ErrNoDifferential
+			}
+			if from, to := hashNameOf(from), hashNameOf(to); from != to {
+				return errors.Errorf("diffdb: RestoreMerge: backup uses hash algorithm %q but the differential uses %q", from, to)
+			}
+
+			summary = MergeSummary{}
+			bh := to.Bucket(bucketHashes)
+			return from.Bucket(bucketHashes).ForEach(func(id, hash []byte) error {
+				existing := bh.Get(id)
+				switch {
+				case existing == nil:
+					summary.Added++
+				case bytes.Equal(existing, hash):
+					summary.Unchanged++
+					return nil
+				case policy == MergeSkip:
+					summary.Skipped++
+					return nil
+				case policy == MergeError:
+					return errors.Wrapf(ErrMergeConflict, "diffdb: RestoreMerge: id %x", id)
+				default:
+					summary.Overwritten++
+					if isTombstone(existing) {
+						if err := adjustTombstones(to, -1); err != nil {
+							return err
+						}
+					}
+					for _, name := range [][]byte{bucketCommittedData, bucketCommittedVersions} {
+						if bo := to.Bucket(name); bo != nil {
+							if err := bo.Delete(id); err != nil {
+								return err
+							}
+						}
+					}
+				}
+				return bh.Put(id, append([]byte(nil), hash...))
+			})
+		})
+	})
+	return
+}
+
+// hashNameOf returns the name of the hash algorithm recorded for the differential bucket b.
+func hashNameOf(b *bolt.Bucket) string {
+	if bm := b.Bucket(bucketDiffMeta); bm != nil {
+		if name := bm.Get(keyHashName); len(name) > 0 {
+			return string(name)
+		}
+	}
+	return DefaultHash
+}
@@ -0,0 +1,113 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDB_RestoreMerge(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply := func(objs map[string]string) {
+		for id, v := range objs {
+			if _, err := diff.Add(NewIDObject([]byte(id), v)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	apply(map[string]string{"a": "1", "b": "2"})
+	var backup bytes.Buffer
+	if _, err := db.Backup(&backup); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := diff.Reset(true); err != nil {
+		t.Fatal(err)
+	}
+	apply(map[string]string{"a": "1", "b": "changed", "c": "3"})
+	changed, err := diff.CommittedHash([]byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.RestoreMerge("test", bytes.NewReader(backup.Bytes()), MergeError); !errors.Is(err, ErrMergeConflict) {
+		t.Fatalf("Expected %q; got %v", ErrMergeConflict, err)
+	}
+
+	summary, err := db.RestoreMerge("test", bytes.NewReader(backup.Bytes()), MergeSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != (MergeSummary{Skipped: 1, Unchanged: 1}) {
+		t.Fatalf("Unexpected summary %+v", summary)
+	}
+	if hash, _ := diff.CommittedHash([]byte("b")); !bytes.Equal(hash, changed) {
+		t.Fatal("Expected the conflicting hash to be kept")
+	}
+
+	summary, err = db.RestoreMerge("test", bytes.NewReader(backup.Bytes()), MergeOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != (MergeSummary{Overwritten: 1, Unchanged: 1}) {
+		t.Fatalf("Unexpected summary %+v", summary)
+	}
+	if hash, _ := diff.CommittedHash([]byte("b")); bytes.Equal(hash, changed) {
+		t.Fatal("Expected the conflicting hash to be overwritten")
+	}
+	if tracking := diff.CountTracking(); tracking != 3 {
+		t.Fatalf("Expected 3 tracked IDs; got %d", tracking)
+	}
+
+	if _, err := db.RestoreMerge("missing", bytes.NewReader(backup.Bytes()), MergeSkip); !errors.Is(err, ErrNoDifferential) {
+		t.Fatalf("Expected %q; got %v", ErrNoDifferential, err)
+	}
+}
+
+func TestDB_RestoreMerge_OverwriteRetained(t *testing.T) {
+	db, done := openTestDB(t, WithRetainCommitted())
+	defer done()
+
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply := func(email string) {
+		if err := diff.AddPatch([]byte("a"), map[string]interface{}{"Email": email}); err != nil {
+			t.Fatal(err)
+		}
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	apply("backup@example.com")
+	var backup bytes.Buffer
+	if _, err := db.Backup(&backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Reset(true); err != nil {
+		t.Fatal(err)
+	}
+	apply("local@example.com")
+
+	if _, err := db.RestoreMerge("test", bytes.NewReader(backup.Bytes()), MergeOverwrite); err != nil {
+		t.Fatal(err)
+	}
+
+	// The retained payload of the local object no longer matches the committed hash, so it must not be patched
+	if err := diff.AddPatch([]byte("a"), map[string]interface{}{"Name": "a"}); !errors.Is(err, ErrNotRetained) {
+		t.Fatalf("Expected %q; got %v", ErrNotRetained, err)
+	}
+}
@@ -0,0 +1,22 @@
+package diffdb
+
+import "github.com/boltdb/bolt"
+
+// keyResume is the reserved user data key holding the ID of the last change successfully applied by Each
+var keyResume = []byte("_diffdb.resume")
+
+// ResumeFrom returns the ID of the last change successfully applied by any call to Each or its variants,
+// or nil if no change has been applied.
+// The ID is stored in the user data bucket under a reserved key and is committed in the same transaction
+// as the applied changes, so it can be used as a high-water mark to coordinate exactly-once delivery
+// with a downstream system after a crash.
+// It is kept by Reset if user data is kept.
+func (diff *Differential) ResumeFrom() (id []byte, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(diff.q).Bucket(bucketUserData).Get(keyResume); v != nil {
+			id = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,58 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestDifferential_ResumeFrom(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	id, err := diff.ResumeFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != nil {
+		t.Fatalf("Expected no resume point; got %q", id)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := diff.Add(NewIDObject([]byte(strconv.Itoa(i)), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Interrupt applying after the third change
+	err = diff.Each(context.Background(), func(id []byte, data Decoder) error {
+		if string(id) == "3" {
+			return errors.New("interrupted")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	id, err = diff.ResumeFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(id, []byte("4")) {
+		t.Fatalf("Expected resume point %q; got %q", "4", id)
+	}
+
+	if err := diff.EachN(context.Background(), func(id []byte, data Decoder) error { return nil }, 1); err != nil {
+		t.Fatal(err)
+	}
+	id, err = diff.ResumeFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(id, []byte("3")) {
+		t.Fatalf("Expected resume point %q; got %q", "3", id)
+	}
+}
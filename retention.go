@@ -0,0 +1,96 @@
+package diffdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+// ErrNoRetention indicates that PruneRetained was called on a differential without a positive retention period
+// set by WithAppliedRetention.
+var ErrNoRetention = errors.New("diffdb: no applied retention period is set")
+
+// WithAppliedRetention keeps the payload of each change applied by Each for at least d
+// so that a consumer reading behind the applier can still fetch it with Retained.
+// Retained payloads are not removed automatically; call PruneRetained periodically to remove expired payloads.
+func WithAppliedRetention(d time.Duration) Option {
+	return func(db *DB) {
+		db.retention = d
+	}
+}
+
+// retainApplied stores the applied payload data of id in the retained bucket of b along with the time it was applied.
+// Retained values are the applied time in Unix nanoseconds as a big endian uint64 followed by the payload.
+func retainApplied(b *bolt.Bucket, id, data []byte, applied time.Time) error {
+	br, err := b.CreateBucketIfNotExists(bucketRetained)
+	if err != nil {
+		return err
+	}
+
+	v := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(v, uint64(applied.UnixNano()))
+	copy(v[8:], data)
+	return br.Put(id, v)
+}
+
+// Retained decodes the most recently applied payload of id retained by WithAppliedRetention into x.
+// found is false if no payload is retained for id, in which case x is not modified.
+// Expired payloads may still be found until they are removed by PruneRetained.
+func (diff *Differential) Retained(id []byte, x interface{}) (found bool, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		br := tx.Bucket(diff.q).Bucket(bucketRetained)
+		if br == nil {
+			return nil
+		}
+		v := br.Get(id)
+		if v == nil {
+			return nil
+		}
+
+		found = true
+		d := msgpackDecoder{data: v[8:]}
+		return d.Decode(x)
+	})
+	return
+}
+
+// PruneRetained removes retained payloads that were applied longer ago than the retention period
+// set by WithAppliedRetention, returning the number of payloads removed.
+// It is safe to call concurrently with other operations, such as from a background goroutine.
+// If the differential was opened without a positive retention period then ErrNoRetention is returned
+// and nothing is removed, rather than treating every retained payload as expired.
+func (diff *Differential) PruneRetained() (removed int, err error) {
+	if diff.retention <= 0 {
+		return 0, ErrNoRetention
+	}
+	err = diff.updateOp(func(tx *bolt.Tx) error {
+		removed = 0
+		br := tx.Bucket(diff.q).Bucket(bucketRetained)
+		if br == nil {
+			return nil
+		}
+
+		expiry := uint64(time.Now().Add(-diff.retention).UnixNano())
+
+		var expired [][]byte
+		err := br.ForEach(func(id, v []byte) error {
+			if binary.BigEndian.Uint64(v) < expiry {
+				expired = append(expired, append([]byte(nil), id...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range expired {
+			if err := br.Delete(id); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+		return nil
+	})
+	return
+}
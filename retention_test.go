@@ -0,0 +1,77 @@
+package diffdb
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDifferential_Retained(t *testing.T) {
+	diff, done := openTestDifferential(t, "test", WithAppliedRetention(time.Hour))
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	var obj struct {
+		Object int
+	}
+	found, err := diff.Retained([]byte("a"), &obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || obj.Object != 1 {
+		t.Fatalf("Expected retained payload 1; got %+v (found %t)", obj, found)
+	}
+
+	removed, err := diff.PruneRetained()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 {
+		t.Fatalf("Expected no payloads to be pruned within the retention period; got %d", removed)
+	}
+
+	// Shorten the retention period so the payload has expired
+	diff.retention = time.Nanosecond
+	time.Sleep(time.Millisecond)
+
+	removed, err = diff.PruneRetained()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("Expected 1 payload to be pruned; got %d", removed)
+	}
+	if found, err := diff.Retained([]byte("a"), &obj); err != nil || found {
+		t.Fatalf("Expected payload to be pruned; got found %t, err %v", found, err)
+	}
+}
+
+func TestDifferential_PruneRetained_NoRetention(t *testing.T) {
+	diff, done := openTestDifferential(t, "test", WithAppliedRetention(time.Hour))
+	defer done()
+
+	if _, err := diff.Add(NewIDObject([]byte("a"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// A differential opened without a retention period must not prune payloads retained by an earlier one
+	diff.retention = 0
+	if _, err := diff.PruneRetained(); err != ErrNoRetention {
+		t.Fatalf("Expected %q; got %v", ErrNoRetention, err)
+	}
+	var obj struct {
+		Object int
+	}
+	if found, err := diff.Retained([]byte("a"), &obj); err != nil || !found {
+		t.Fatalf("Expected the payload to be kept; got found %t, err %v", found, err)
+	}
+}
@@ -0,0 +1,66 @@
+package diffdb
+
+import (
+	"errors"
+	"github.com/boltdb/bolt"
+	"syscall"
+	"time"
+)
+
+// WithTxRetry retries write transactions that fail with a transient error up to attempts times in total,
+// waiting backoff before the first retry and doubling the wait before each subsequent retry.
+// This makes operations such as Add and Each more robust on storage that occasionally fails,
+// such as a network filesystem (which BoltDB does not recommend).
+//
+// An error is considered transient if it is, or wraps, syscall.EINTR, syscall.EAGAIN or syscall.EBUSY
+// and occurred while beginning or committing the transaction.
+// Errors returned while staging or applying a change, including those returned by an ApplyFunc, are never retried.
+// If Each is retried then changes applied before the failed commit are given to the ApplyFunc again,
+// as they would be by calling Each again.
+// AddChan and AddStream are not retried as their input cannot be replayed.
+func WithTxRetry(attempts int, backoff time.Duration) Option {
+	return func(db *DB) {
+		db.retry = txRetry{attempts: attempts, backoff: backoff}
+	}
+}
+
+// txRetry is a policy for retrying transactions that fail with a transient error.
+// The zero value never retries.
+type txRetry struct {
+	attempts int
+	backoff  time.Duration
+}
+
+// do calls run until it succeeds, returns an error that is not transient, is not retryable or the attempts are exhausted.
+// run reports whether the error it returns occurred at a point in the transaction where it may be retried.
+func (r txRetry) do(run func() (retryable bool, err error)) error {
+	wait := r.backoff
+	for i := 1; ; i++ {
+		retryable, err := run()
+		if err == nil || !retryable || !isTransient(err) || i >= r.attempts {
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// isTransient returns true if err is a transient system error.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EBUSY)
+}
+
+// update runs f in a write transaction, retrying according to the differential's retry policy
+// if the transaction fails to begin or commit.
+// f may be called more than once so it must not accumulate state between calls.
+func (diff *Differential) update(f func(tx *bolt.Tx) error) error {
+	return diff.retry.do(func() (bool, error) {
+		var failed bool
+		err := diff.db.Update(func(tx *bolt.Tx) error {
+			err := f(tx)
+			failed = err != nil
+			return err
+		})
+		return !failed, err
+	})
+}
@@ -0,0 +1,67 @@
+package diffdb
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestTxRetry(t *testing.T) {
+	r := txRetry{attempts: 3}
+
+	var calls int
+	err := r.do(func() (bool, error) {
+		calls++
+		if calls < 3 {
+			return true, fmt.Errorf("commit: %w", syscall.EAGAIN)
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 attempts; got %d", calls)
+	}
+
+	calls = 0
+	err = r.do(func() (bool, error) {
+		calls++
+		return true, syscall.EINTR
+	})
+	if err != syscall.EINTR {
+		t.Fatalf("Expected %q; got %v", syscall.EINTR, err)
+	}
+	if calls != 3 {
+		t.Fatalf("Expected attempts to be exhausted after 3; got %d", calls)
+	}
+
+	// Errors that are not transient, or that occurred inside the transaction, are not retried
+	for _, c := range []struct {
+		retryable bool
+		err       error
+	}{
+		{true, errors.New("permanent")},
+		{false, syscall.EBUSY},
+	} {
+		calls = 0
+		r.do(func() (bool, error) {
+			calls++
+			return c.retryable, c.err
+		})
+		if calls != 1 {
+			t.Fatalf("Expected %v not to be retried; got %d attempts", c.err, calls)
+		}
+	}
+
+	// The zero value never retries
+	calls = 0
+	txRetry{}.do(func() (bool, error) {
+		calls++
+		return true, syscall.EAGAIN
+	})
+	if calls != 1 {
+		t.Fatalf("Expected 1 attempt; got %d", calls)
+	}
+}
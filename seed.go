@@ -0,0 +1,83 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// SeedBaseline records each object in objs as already committed without staging any pending changes,
+// so that a differential can be bootstrapped from a source that is known to be in sync with downstream.
+// Subsequent calls to Add only stage objects that differ from the baseline.
+// Objects are transformed and hashed in the same way as Add, and their payloads are kept
+// if WithRetainCommitted is used. Pending changes of the seeded IDs are left unchanged.
+//
+// All objects are seeded in a single transaction. If an error occurs or the context is cancelled
+// then no objects are seeded.
+func (diff *Differential) SeedBaseline(ctx context.Context, objs []Object) error {
+	if err := diff.ops.begin(); err != nil {
+		return err
+	}
+	defer diff.ops.end()
+
+	return diff.update(func(tx *bolt.Tx) error {
+		var (
+			b  = tx.Bucket(diff.q)
+			bh = b.Bucket(bucketHashes)
+		)
+
+		for _, obj := range objs {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+
+			id, x := obj.ID(), interface{}(obj)
+			if diff.transform != nil {
+				var err error
+				x, err = diff.transform(x)
+				if err != nil {
+					return err
+				}
+				if o, ok := x.(Object); ok {
+					id = o.ID()
+				}
+			}
+			if len(id) == 0 {
+				return ErrEmptyID
+			}
+			if err := diff.checkType(b, x); err != nil {
+				return err
+			}
+
+			hash, err := diff.hash(x)
+			if err != nil {
+				return errors.Wrapf(err, "diffdb: SeedBaseline: hash object for id %x", id)
+			}
+			if isTombstone(bh.Get(id)) {
+				if err := adjustTombstones(b, -1); err != nil {
+					return errors.Wrapf(err, "diffdb: SeedBaseline: store hash for id %x", id)
+				}
+			}
+			if err := bh.Put(id, hash); err != nil {
+				return errors.Wrapf(err, "diffdb: SeedBaseline: store hash for id %x", id)
+			}
+
+			if diff.retain {
+				raw, err := encodePayload(x, diff.codec)
+				if err != nil {
+					return errors.Wrapf(err, "diffdb: SeedBaseline: marshal payload for id %x", id)
+				}
+				bcd, err := b.CreateBucketIfNotExists(bucketCommittedData)
+				if err != nil {
+					return err
+				}
+				if err := bcd.Put(id, raw); err != nil {
+					return errors.Wrapf(err, "diffdb: SeedBaseline: store payload for id %x", id)
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,45 @@
+package diffdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDifferential_SeedBaseline(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	err := diff.SeedBaseline(context.Background(), []Object{
+		NewIDObject([]byte("a"), 1),
+		NewIDObject([]byte("b"), 2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracking := diff.CountTracking(); tracking != 2 {
+		t.Fatalf("Expected 2 tracked IDs; got %d", tracking)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected no pending changes; got %d", pending)
+	}
+
+	// Only genuine deltas are staged
+	for _, obj := range []Object{NewIDObject([]byte("a"), 1), NewIDObject([]byte("b"), 3)} {
+		if _, err := diff.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids, err := diff.PendingIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || string(ids[0]) != "b" {
+		t.Fatalf("Expected only b to be pending; got %q", ids)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := diff.SeedBaseline(ctx, []Object{NewIDObject([]byte("c"), 4)}); err != context.Canceled {
+		t.Fatalf("Expected %q; got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,139 @@
+package diffdb
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/boltdb/bolt"
+)
+
+// keyOrderedCursor is the user data key holding the sequence number of the last change applied by EachOrdered
+var keyOrderedCursor = []byte("_diffdb.cursor")
+
+// WithSequenceNumbers assigns a monotonically increasing sequence number to each change staged by Add,
+// so that pending changes can be applied in the order they were staged with EachOrdered.
+// Staging a new version of a pending change gives it a new sequence number.
+// Reset restarts sequence numbers from 1, so consumers tracking their position with EachOrdered must restart too.
+func WithSequenceNumbers() Option {
+	return func(db *DB) {
+		db.sequence = true
+	}
+}
+
+// assignSequence gives the pending change of id in b the next sequence number.
+func assignSequence(b *bolt.Bucket, id []byte) error {
+	bsq, err := b.CreateBucketIfNotExists(bucketSequence)
+	if err != nil {
+		return err
+	}
+	bsi, err := b.CreateBucketIfNotExists(bucketSequenceIDs)
+	if err != nil {
+		return err
+	}
+
+	if prev := bsi.Get(id); prev != nil {
+		if err := bsq.Delete(prev); err != nil {
+			return err
+		}
+	}
+
+	n, err := bsq.NextSequence()
+	if err != nil {
+		return err
+	}
+	seq := make([]byte, 8)
+	binary.BigEndian.PutUint64(seq, n)
+	if err := bsq.Put(seq, id); err != nil {
+		return err
+	}
+	return bsi.Put(id, seq)
+}
+
+// releaseSequence removes the sequence number of id in b once its change is no longer pending.
+func releaseSequence(b *bolt.Bucket, id []byte) error {
+	bsi := b.Bucket(bucketSequenceIDs)
+	if bsi == nil {
+		return nil
+	}
+	seq := bsi.Get(id)
+	if seq == nil {
+		return nil
+	}
+	if err := b.Bucket(bucketSequence).Delete(seq); err != nil {
+		return err
+	}
+	return bsi.Delete(id)
+}
+
+// ApplyOrderedFunc is a function to be called to apply each pending change given to EachOrdered along with its sequence number.
+type ApplyOrderedFunc func(seq uint64, id []byte, data Decoder) error
+
+// EachOrdered applies pending changes with a sequence number of at least from, in the order they were staged,
+// which provides resumable, append-only processing similar to a consumer offset over the stream of changes.
+// Only changes staged while WithSequenceNumbers is used have a sequence number.
+//
+// The sequence number of each applied change is stored in user data atomically with the change,
+// and can be read with OrderedCursor to resume processing from the next sequence number.
+// The cursor is the greatest sequence number applied; changes that fail to apply remain pending
+// and can be retried with EachFailed, but are not revisited by resuming EachOrdered after the cursor.
+func (diff *Differential) EachOrdered(ctx context.Context, from uint64, f ApplyOrderedFunc) error {
+	var seq uint64
+	apply := func(id []byte, _ ChangeMeta, data Decoder, tx *bolt.Tx) error {
+		if err := f(seq, id, data); err != nil {
+			return err
+		}
+		cursor := make([]byte, 8)
+		binary.BigEndian.PutUint64(cursor, seq)
+		return tx.Bucket(diff.q).Bucket(bucketUserData).Put(keyOrderedCursor, cursor)
+	}
+
+	return diff.each(ctx, apply, -1, func(b *bolt.Bucket) (changeCursor, error) {
+		return &sequenceCursor{b: b, from: from, seq: &seq}, nil
+	})
+}
+
+// OrderedCursor returns the sequence number of the last change applied by EachOrdered, or 0 if there is none.
+func (diff *Differential) OrderedCursor() (seq uint64, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(diff.q).Bucket(bucketUserData).Get(keyOrderedCursor); len(v) == 8 {
+			seq = binary.BigEndian.Uint64(v)
+		}
+		return nil
+	})
+	return
+}
+
+// sequenceCursor is a changeCursor over pending changes in sequence order starting at from.
+// The sequence number of the current change is stored in seq.
+type sequenceCursor struct {
+	b    *bolt.Bucket
+	from uint64
+	seq  *uint64
+}
+
+func (s *sequenceCursor) First() (id []byte, hash []byte) {
+	return s.seek(s.from)
+}
+
+func (s *sequenceCursor) Next() (id []byte, hash []byte) {
+	return s.seek(*s.seq + 1)
+}
+
+// seek returns the first pending change with a sequence number of at least n.
+// The cursor is repositioned on every call as applied changes release their sequence numbers.
+func (s *sequenceCursor) seek(n uint64) ([]byte, []byte) {
+	bsq := s.b.Bucket(bucketSequence)
+	if bsq == nil {
+		return nil, nil
+	}
+
+	var start [8]byte
+	binary.BigEndian.PutUint64(start[:], n)
+	c := bsq.Cursor()
+	for seq, id := c.Seek(start[:]); seq != nil; seq, id = c.Next() {
+		*s.seq = binary.BigEndian.Uint64(seq)
+		if hash := s.b.Bucket(bucketPendingHashes).Get(id); hash != nil {
+			return id, hash
+		}
+	}
+	return nil, nil
+}
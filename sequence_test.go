@@ -0,0 +1,73 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDifferential_EachOrdered(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_each_ordered", WithSequenceNumbers())
+	defer done()
+
+	for _, id := range []string{"c", "a", "b", "d"} {
+		if _, err := diff.Add(NewIDObject([]byte(id), id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Staging a new version moves a change to the end
+	if _, err := diff.Add(NewIDObject([]byte("a"), "a2")); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ids      []string
+		errFail  = errors.New("fail")
+		lastSeen uint64
+	)
+	err := diff.EachOrdered(context.Background(), 0, func(seq uint64, id []byte, data Decoder) error {
+		if seq <= lastSeen {
+			t.Errorf("Expected increasing sequence numbers; got %d after %d", seq, lastSeen)
+		}
+		lastSeen = seq
+		ids = append(ids, string(id))
+		if string(id) == "d" {
+			return errFail
+		}
+		return nil
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("Expected %q; got %v", errFail, err)
+	}
+	if expect := "c,b,d,a"; strings.Join(ids, ",") != expect {
+		t.Fatalf("Expected changes in order %s; got %v", expect, ids)
+	}
+
+	cursor, err := diff.OrderedCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor != lastSeen {
+		t.Fatalf("Expected the cursor to be %d; got %d", lastSeen, cursor)
+	}
+
+	// Resuming after the cursor only sees changes staged since
+	if _, err := diff.Add(NewIDObject([]byte("e"), "e")); err != nil {
+		t.Fatal(err)
+	}
+	ids = nil
+	err = diff.EachOrdered(context.Background(), cursor+1, func(seq uint64, id []byte, data Decoder) error {
+		ids = append(ids, string(id))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "e"; strings.Join(ids, ",") != expect {
+		t.Fatalf("Expected changes %s; got %v", expect, ids)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected the failed change to remain pending; got %d pending", pending)
+	}
+}
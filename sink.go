@@ -0,0 +1,63 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// A Sink is a transactional downstream, such as a SQL database, that pending changes are applied to by EachSink.
+type Sink interface {
+	// Begin starts a transaction in the sink.
+	Begin(ctx context.Context) error
+	// Apply applies a single change within the sink's transaction.
+	// If it returns an error then the change is marked as failed and is not committed,
+	// so the sink must not commit any partial effects of the change.
+	// Returning ErrSkip leaves the change pending without reporting an error.
+	Apply(id []byte, data Decoder) error
+	// Commit commits the sink's transaction.
+	Commit() error
+	// Rollback aborts the sink's transaction.
+	Rollback() error
+}
+
+// EachSink applies each pending change to sink, coordinating the sink's transaction with the differential's.
+// Changes applied by the sink are only committed to the differential after the sink commits successfully,
+// and if the sink fails to commit then the differential is rolled back so every change remains pending.
+// If committing the differential fails after the sink has committed then the changes remain pending
+// and will be applied to the sink again, so the sink should apply changes idempotently
+// or use ResumeFrom to detect changes it has already applied.
+// EachSink is not retried by WithTxRetry.
+func (diff *Differential) EachSink(ctx context.Context, sink Sink) error {
+	if err := diff.ops.begin(); err != nil {
+		return err
+	}
+	defer diff.ops.end()
+
+	tx, err := diff.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	diff.observeTxStats(tx, "each")
+
+	if err := sink.Begin(ctx); err != nil {
+		return errors.Wrap(err, "diffdb: EachSink: begin sink")
+	}
+
+	updateErr, err := diff.eachTx(ctx, tx, func(id []byte, _ ChangeMeta, data Decoder, _ *bolt.Tx) error {
+		return sink.Apply(id, data)
+	}, -1, openPendingCursor, nil)
+	if err != nil {
+		sink.Rollback()
+		return err
+	}
+
+	if err := sink.Commit(); err != nil {
+		return errors.Wrap(err, "diffdb: EachSink: commit sink")
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "diffdb: EachSink: commit")
+	}
+	return updateErr.ErrorOrNil()
+}
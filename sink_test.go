@@ -0,0 +1,68 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// memorySink is a Sink that stages applied IDs until it is committed
+type memorySink struct {
+	staged, committed []string
+	commitErr         error
+}
+
+func (s *memorySink) Begin(ctx context.Context) error {
+	s.staged = nil
+	return nil
+}
+
+func (s *memorySink) Apply(id []byte, data Decoder) error {
+	s.staged = append(s.staged, string(id))
+	return nil
+}
+
+func (s *memorySink) Commit() error {
+	if s.commitErr != nil {
+		return s.commitErr
+	}
+	s.committed = append(s.committed, s.staged...)
+	return nil
+}
+
+func (s *memorySink) Rollback() error {
+	s.staged = nil
+	return nil
+}
+
+func TestDifferential_EachSink(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	for _, obj := range []Object{NewIDObject([]byte("a"), 1), NewIDObject([]byte("b"), 2)} {
+		if _, err := diff.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A failed sink commit leaves every change pending
+	failure := errors.New("commit failed")
+	sink := &memorySink{commitErr: failure}
+	if err := diff.EachSink(context.Background(), sink); !errors.Is(err, failure) {
+		t.Fatalf("Expected %q; got %v", failure, err)
+	}
+	if pending := diff.CountChanges(); pending != 2 {
+		t.Fatalf("Expected 2 pending changes; got %d", pending)
+	}
+
+	sink.commitErr = nil
+	if err := diff.EachSink(context.Background(), sink); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.committed) != 2 {
+		t.Fatalf("Expected 2 committed changes in the sink; got %q", sink.committed)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected no pending changes; got %d", pending)
+	}
+}
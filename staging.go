@@ -0,0 +1,101 @@
+package diffdb
+
+import "github.com/boltdb/bolt"
+
+// Staging is an explicit write transaction used to stage a set of changes to a differential,
+// created with Differential.Begin.
+// Changes added to a Staging are only visible to other transactions once Commit is called,
+// and are discarded by Rollback.
+//
+// A Staging holds the database write lock, so every Staging must be committed or rolled back promptly.
+// A Staging that is never finished is counted as an in-flight operation,
+// so CloseContext will report ErrBusy rather than closing the database underneath it.
+// A Staging must not be used by multiple goroutines at the same time.
+type Staging struct {
+	diff *Differential
+	tx   *bolt.Tx
+}
+
+// Begin starts a Staging transaction on the differential.
+// It blocks until no other write transaction is open on the database.
+func (diff *Differential) Begin() (*Staging, error) {
+	if err := diff.ops.begin(); err != nil {
+		return nil, err
+	}
+
+	tx, err := diff.db.Begin(true)
+	if err != nil {
+		diff.ops.end()
+		return nil, err
+	}
+
+	return &Staging{diff: diff, tx: tx}, nil
+}
+
+// Add stages obj as a pending change in the same way as Differential.Add.
+func (s *Staging) Add(obj Object) (updated bool, err error) {
+	if s.tx == nil {
+		return false, bolt.ErrTxClosed
+	}
+	return s.diff.AddTx(s.tx, obj)
+}
+
+// Discard discards any pending change of id, including one staged earlier in the same transaction,
+// along with its failed marker, sequence number and pending version.
+// The committed hash of id is left unchanged; use Differential.Remove to record a deletion.
+func (s *Staging) Discard(id []byte) error {
+	if s.tx == nil {
+		return bolt.ErrTxClosed
+	}
+
+	var (
+		b   = s.tx.Bucket(s.diff.q)
+		bph = b.Bucket(bucketPendingHashes)
+	)
+
+	hash := bph.Get(id)
+	if hash == nil {
+		return nil
+	}
+	if err := payloadsOf(b).Delete(hash); err != nil {
+		return err
+	}
+	if err := b.Bucket(bucketFailed).Delete(id); err != nil {
+		return err
+	}
+	if err := releaseSequence(b, id); err != nil {
+		return err
+	}
+	if bpv := b.Bucket(bucketPendingVersions); bpv != nil {
+		if err := bpv.Delete(id); err != nil {
+			return err
+		}
+	}
+	return bph.Delete(id)
+}
+
+// Commit commits the staged changes.
+// The Staging cannot be used after Commit returns, even if it returns an error.
+func (s *Staging) Commit() error {
+	if s.tx == nil {
+		return bolt.ErrTxClosed
+	}
+	defer s.done()
+	return s.tx.Commit()
+}
+
+// Rollback discards the staged changes.
+// The Staging cannot be used after Rollback returns.
+func (s *Staging) Rollback() error {
+	if s.tx == nil {
+		return bolt.ErrTxClosed
+	}
+	defer s.done()
+	return s.tx.Rollback()
+}
+
+// done releases the Staging once its transaction is closed.
+func (s *Staging) done() {
+	s.tx = nil
+	s.diff.ops.end()
+}
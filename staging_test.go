@@ -0,0 +1,116 @@
+package diffdb
+
+import (
+	"context"
+	"github.com/boltdb/bolt"
+	"testing"
+	"time"
+)
+
+func TestDifferential_Begin(t *testing.T) {
+	diff, done := openTestDifferential(t, "test")
+	defer done()
+
+	s, err := diff.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range []Object{NewIDObject([]byte("a"), 1), NewIDObject([]byte("b"), 2)} {
+		if _, err := s.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Discard([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rollback(); err != bolt.ErrTxClosed {
+		t.Fatalf("Expected %q; got %v", bolt.ErrTxClosed, err)
+	}
+
+	ids, err := diff.PendingIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || string(ids[0]) != "a" {
+		t.Fatalf("Expected only a to be pending; got %q", ids)
+	}
+
+	s, err = diff.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(NewIDObject([]byte("c"), 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(NewIDObject([]byte("d"), 4)); err != bolt.ErrTxClosed {
+		t.Fatalf("Expected %q; got %v", bolt.ErrTxClosed, err)
+	}
+	if pending := diff.CountChanges(); pending != 1 {
+		t.Fatalf("Expected 1 pending change; got %d", pending)
+	}
+}
+
+func TestDifferential_Begin_Unfinished(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	diff, err := db.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := diff.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An unfinished Staging is detected when closing the database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := db.CloseContext(ctx); err != ErrBusy {
+		t.Fatalf("Expected %q; got %v", ErrBusy, err)
+	}
+
+	if err := s.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaging_Discard(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_discard", WithSequenceNumbers(), WithVersionField("Version"))
+	defer done()
+
+	s, err := diff.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(versionedObject{Key: "a", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Discard([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = diff.ViewUserDataTx(func(tx *bolt.Tx, _ *bolt.Bucket) error {
+		b := tx.Bucket(diff.q)
+		if n := b.Bucket(bucketSequence).Stats().KeyN; n != 0 {
+			t.Errorf("Expected the sequence number of a to be released; got %d sequence numbers", n)
+		}
+		if b.Bucket(bucketPendingVersions).Get([]byte("a")) != nil {
+			t.Error("Expected the pending version of a to be discarded")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,128 @@
+package diffdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// ErrInvalidRecord indicates that a stream given to AddStream has a corrupt length prefix or a truncated record.
+var ErrInvalidRecord = errors.New("diffdb: invalid stream record")
+
+// maxStreamRecord is the maximum length of a record accepted by AddStream,
+// guarding against allocating huge buffers for a corrupt length prefix.
+const maxStreamRecord = 1 << 26
+
+// streamBatchSize is the number of records staged in a single transaction by AddStream.
+const streamBatchSize = 1000
+
+// AddStream reads length-prefixed records from r until EOF, decoding each one into an Object using decode
+// and adding it to the list of pending changes.
+// Each record is prefixed by its length encoded as an unsigned varint (see encoding/binary.PutUvarint).
+// A record longer than 64 MiB, a corrupt length prefix or a truncated record returns an error wrapping ErrInvalidRecord.
+// Records are staged in batches, each in its own transaction, so that the stream never has to be held in memory.
+// Batches already staged remain staged if an error occurs or the context is cancelled.
+//
+// AddStream returns the number of objects that were changed.
+func (diff *Differential) AddStream(ctx context.Context, r io.Reader, decode func([]byte) (Object, error)) (int, error) {
+	if err := diff.ops.begin(); err != nil {
+		return 0, err
+	}
+	defer diff.ops.end()
+
+	var (
+		br      = bufio.NewReader(r)
+		changed int
+		eof     bool
+	)
+
+	for !eof {
+		n, err := diff.addStreamBatch(ctx, br, decode)
+		changed += n
+		if err == io.EOF {
+			eof = true
+			continue
+		}
+		if err != nil {
+			return changed, err
+		}
+	}
+
+	return changed, nil
+}
+
+// addStreamBatch stages up to streamBatchSize records from r in a single transaction.
+// io.EOF is returned once the stream is exhausted, in which case the batch is still committed.
+func (diff *Differential) addStreamBatch(ctx context.Context, r *bufio.Reader, decode func([]byte) (Object, error)) (int, error) {
+	tx, err := diff.db.Begin(true)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	diff.observeTxStats(tx, "add")
+
+	var changed int
+	var eof error
+
+	for i := 0; i < streamBatchSize; i++ {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		default:
+		}
+
+		record, err := readRecord(r)
+		if err == io.EOF {
+			eof = err
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		obj, err := decode(record)
+		if err != nil {
+			return 0, err
+		}
+
+		updated, err := diff.AddTx(tx, obj)
+		if err != nil {
+			return 0, err
+		}
+		if updated {
+			changed++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return changed, eof
+}
+
+// readRecord reads a single uvarint length-prefixed record from r.
+// io.EOF is only returned if the stream ends cleanly before the start of a record.
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	// Errors reading the start of a record, including io.EOF, come from the stream rather than its contents
+	if _, err := r.Peek(1); err != nil {
+		return nil, err
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidRecord, "diffdb: AddStream: bad length prefix: %v", err)
+	}
+	if n > maxStreamRecord {
+		return nil, errors.Wrapf(ErrInvalidRecord, "diffdb: AddStream: record of %d bytes exceeds the maximum of %d", n, maxStreamRecord)
+	}
+
+	record := make([]byte, n)
+	if _, err := io.ReadFull(r, record); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, errors.Wrapf(ErrInvalidRecord, "diffdb: AddStream: truncated record of %d bytes", n)
+	} else if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
@@ -0,0 +1,77 @@
+package diffdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func writeRecord(w io.Writer, record []byte) {
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(record)))
+	w.Write(prefix[:n])
+	w.Write(record)
+}
+
+func TestDifferential_AddStream(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_stream")
+	defer done()
+
+	var buf bytes.Buffer
+	for _, v := range []string{"a", "b", "a", "c"} {
+		writeRecord(&buf, []byte(v))
+	}
+
+	changed, err := diff.AddStream(context.Background(), &buf, func(record []byte) (Object, error) {
+		return NewIDObject(record, string(record)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 3 {
+		t.Fatalf("Expected 3 changed objects; got %d", changed)
+	}
+	if pending := diff.CountChanges(); pending != 3 {
+		t.Fatalf("Expected 3 pending changes; got %d", pending)
+	}
+}
+
+func TestDifferential_AddStream_Truncated(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_stream_truncated")
+	defer done()
+
+	var buf bytes.Buffer
+	writeRecord(&buf, []byte("abc"))
+	buf.Truncate(buf.Len() - 1)
+
+	_, err := diff.AddStream(context.Background(), &buf, func(record []byte) (Object, error) {
+		return NewIDObject(record, string(record)), nil
+	})
+	if !errors.Is(err, ErrInvalidRecord) {
+		t.Fatalf("Expected %q; got %v", ErrInvalidRecord, err)
+	}
+}
+
+func TestDifferential_AddStream_CorruptPrefix(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_stream_corrupt_prefix")
+	defer done()
+
+	oversized := make([]byte, binary.MaxVarintLen64)
+	oversized = oversized[:binary.PutUvarint(oversized, 1<<62)]
+
+	for name, prefix := range map[string][]byte{
+		"oversized": oversized,
+		"overflow":  bytes.Repeat([]byte{0xff}, binary.MaxVarintLen64+1),
+		"truncated": {0x80},
+	} {
+		_, err := diff.AddStream(context.Background(), bytes.NewReader(prefix), func(record []byte) (Object, error) {
+			return NewIDObject(record, string(record)), nil
+		})
+		if !errors.Is(err, ErrInvalidRecord) {
+			t.Fatalf("%s: Expected %q; got %v", name, ErrInvalidRecord, err)
+		}
+	}
+}
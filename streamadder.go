@@ -0,0 +1,81 @@
+package diffdb
+
+import "context"
+
+// A StreamAdder adds objects to a differential in batches of a fixed size, created with Differential.NewStreamAdder.
+// It is the ingestion primitive for streaming large numbers of objects: each batch is staged in a single transaction
+// with AddBatch, avoiding the cost of a transaction per object without holding a single transaction open for the whole stream.
+// Objects in the same batch are deduplicated and checked for conflicts exactly as if they were added one at a time.
+//
+// Objects are buffered until their batch is committed, so they must not be modified after being given to Add.
+// Flush or Close must be called once the stream ends to commit the final partial batch.
+// A StreamAdder must not be used by multiple goroutines at the same time.
+type StreamAdder struct {
+	ctx         context.Context
+	diff        *Differential
+	commitEvery int
+	buf         []Object
+	result      AddResult
+	closed      bool
+}
+
+// NewStreamAdder creates a StreamAdder that commits every commitEvery objects.
+// If commitEvery is <= 0 then objects are only committed by Flush and Close.
+// Each batch is committed with ctx, so once ctx is cancelled Add, Flush and Close return the context error
+// and the buffered batch is not committed, allowing a long stream to be abandoned on shutdown.
+func (diff *Differential) NewStreamAdder(ctx context.Context, commitEvery int) *StreamAdder {
+	s := &StreamAdder{ctx: ctx, diff: diff, commitEvery: commitEvery}
+	if commitEvery > 0 {
+		s.buf = make([]Object, 0, commitEvery)
+	}
+	return s
+}
+
+// Add buffers obj, committing the buffered batch once it reaches the commit interval.
+// If committing the batch fails then the error is returned and the batch remains buffered,
+// so that it is committed again by the next call to Add, Flush or Close.
+func (s *StreamAdder) Add(obj Object) error {
+	if s.closed {
+		return ErrClosed
+	}
+	s.buf = append(s.buf, obj)
+	if s.commitEvery > 0 && len(s.buf) >= s.commitEvery {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush commits any buffered objects in a single transaction.
+func (s *StreamAdder) Flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+
+	result, err := s.diff.AddBatch(s.ctx, s.buf)
+	if err != nil {
+		return err
+	}
+
+	s.result.Created += result.Created
+	s.result.Updated += result.Updated
+	s.result.Unchanged += result.Unchanged
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// Close flushes any buffered objects. The StreamAdder cannot be used after Close returns without an error.
+func (s *StreamAdder) Close() error {
+	if s.closed {
+		return nil
+	}
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	s.closed = true
+	return nil
+}
+
+// Result returns the combined outcome of every batch committed so far.
+func (s *StreamAdder) Result() AddResult {
+	return s.result
+}
@@ -0,0 +1,123 @@
+package diffdb
+
+import (
+	"encoding/binary"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// ErrDeleted indicates that an object given to Add has an ID that was deleted with Remove.
+var ErrDeleted = errors.New("diffdb: object was deleted")
+
+// isTombstone reports whether the committed hash of an ID marks it as deleted.
+// A tombstone is a zero-length committed hash, which no hash algorithm produces.
+func isTombstone(committed []byte) bool {
+	return committed != nil && len(committed) == 0
+}
+
+// Remove marks id as deleted, discarding any pending or held change, failed marker, sequence number
+// and committed payload retained by WithRetainCommitted.
+// The committed hash of id is replaced by a tombstone, so id remains tracked and is counted by CountTracking.
+// Adding an object with a deleted ID returns an error wrapping ErrDeleted and nothing is staged,
+// and Changed reports the same error, preventing deleted records from being resurrected by a stale source.
+// Removing an ID that is already deleted has no effect, and removing an ID pinned with Pin
+// returns an error wrapping ErrPinned and leaves it unchanged.
+// A deleted ID can be tracked again once it is removed with ForgetPrefix, ForgetBatch or Reset.
+//
+// Unlike Staging.Discard, which only discards a pending change, Remove records the deletion itself.
+func (diff *Differential) Remove(id []byte) error {
+	if len(id) == 0 {
+		return ErrEmptyID
+	}
+	return diff.updateOp(func(tx *bolt.Tx) error {
+		var (
+			b   = tx.Bucket(diff.q)
+			bph = b.Bucket(bucketPendingHashes)
+		)
+
+		if isPinned(b, id) {
+			return pinnedError(id)
+		}
+		if hash := bph.Get(id); hash != nil {
+			if err := payloadsOf(b).Delete(hash); err != nil {
+				return err
+			}
+			if err := bph.Delete(id); err != nil {
+				return err
+			}
+		}
+		if err := b.Bucket(bucketFailed).Delete(id); err != nil {
+			return err
+		}
+		if err := releaseSequence(b, id); err != nil {
+			return err
+		}
+
+		// The committed payload and version of a deleted ID must not outlive it
+		for _, name := range [][]byte{bucketPendingVersions, bucketHeld, bucketCommittedData, bucketCommittedVersions} {
+			if bo := b.Bucket(name); bo != nil {
+				if err := bo.Delete(id); err != nil {
+					return err
+				}
+			}
+		}
+		bh := b.Bucket(bucketHashes)
+		if !isTombstone(bh.Get(id)) {
+			if err := adjustTombstones(b, 1); err != nil {
+				return err
+			}
+		}
+		return bh.Put(id, []byte{})
+	})
+}
+
+// keyTombstones records the number of tombstones in a differential so that they can be counted without a scan.
+var keyTombstones = []byte("tombstones")
+
+// countTombstones returns the number of tombstones in the differential bucket b.
+// Differentials written before the count was recorded are counted from their committed hashes.
+func countTombstones(b *bolt.Bucket) int {
+	if v := b.Bucket(bucketDiffMeta).Get(keyTombstones); v != nil {
+		n, _ := binary.Uvarint(v)
+		return int(n)
+	}
+	var n int
+	b.Bucket(bucketHashes).ForEach(func(_, hash []byte) error {
+		if isTombstone(hash) {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// putTombstones records n as the number of tombstones in the differential bucket b.
+func putTombstones(b *bolt.Bucket, n int) error {
+	var v [binary.MaxVarintLen64]byte
+	return b.Bucket(bucketDiffMeta).Put(keyTombstones, v[:binary.PutUvarint(v[:], uint64(n))])
+}
+
+// adjustTombstones adds delta to the number of tombstones in the differential bucket b.
+// It must be called before the committed hashes are changed, so that a count that was never recorded
+// is taken from the committed hashes as they were.
+func adjustTombstones(b *bolt.Bucket, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return putTombstones(b, countTombstones(b)+delta)
+}
+
+// IsDeleted returns true if id has been deleted with Remove.
+func (diff *Differential) IsDeleted(id []byte) (deleted bool, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		deleted = isTombstone(tx.Bucket(diff.q).Bucket(bucketHashes).Get(id))
+		return nil
+	})
+	return
+}
+
+// deletedError returns an error wrapping ErrDeleted for id.
+func deletedError(id []byte) error {
+	return errors.Wrapf(ErrDeleted, "diffdb: id %x", id)
+}
@@ -0,0 +1,188 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"github.com/boltdb/bolt"
+	"testing"
+)
+
+func TestDifferential_Remove(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_remove")
+	defer done()
+
+	var id = []byte("a")
+	if _, err := diff.Add(NewIDObject(id, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject(id, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := diff.Remove(id); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := diff.IsDeleted(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted {
+		t.Fatal("Expected the ID to be deleted")
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected the pending change to be discarded; got %d pending", pending)
+	}
+	if tracking := diff.CountTracking(); tracking != 1 {
+		t.Fatalf("Expected the deleted ID to remain tracked; got %d", tracking)
+	}
+
+	if _, err := diff.Add(NewIDObject(id, 1)); !errors.Is(err, ErrDeleted) {
+		t.Fatalf("Expected %q; got %v", ErrDeleted, err)
+	}
+	if _, err := diff.Changed(id, NewIDObject(id, 1)); !errors.Is(err, ErrDeleted) {
+		t.Fatalf("Expected %q; got %v", ErrDeleted, err)
+	}
+
+	if _, err := diff.ForgetPrefix(id); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, _ := diff.IsDeleted(id); deleted {
+		t.Fatal("Expected a forgotten ID not to be deleted")
+	}
+	if _, err := diff.Add(NewIDObject(id, 1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDifferential_CountChangesByType(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_count_changes_by_type")
+	defer done()
+
+	for i := 0; i < 3; i++ {
+		if _, err := diff.Add(NewIDObject([]byte{byte(i)}, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// One update, two creates and one deletion
+	for i := 2; i < 5; i++ {
+		if _, err := diff.Add(NewIDObject([]byte{byte(i)}, i+10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Remove([]byte{0}); err != nil {
+		t.Fatal(err)
+	}
+
+	creates, updates, deletes, err := diff.CountChangesByType()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creates != 2 || updates != 1 || deletes != 1 {
+		t.Fatalf("Expected 2 creates, 1 update and 1 delete; got %d, %d and %d", creates, updates, deletes)
+	}
+}
+
+func TestDifferential_CountChangesByType_Deletes(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_count_changes_by_type_deletes")
+	defer done()
+
+	for _, id := range []string{"a1", "a2", "b1", "b2"} {
+		if _, err := diff.Add(NewIDObject([]byte(id), id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(n int) {
+		t.Helper()
+		_, _, deletes, err := diff.CountChangesByType()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deletes != n {
+			t.Fatalf("Expected %d deletes; got %d", n, deletes)
+		}
+	}
+
+	for _, id := range []string{"a1", "a2", "b1", "b2", "a1"} {
+		if err := diff.Remove([]byte(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(4)
+
+	if _, err := diff.ForgetBatch([][]byte{[]byte("b1")}); err != nil {
+		t.Fatal(err)
+	}
+	expect(3)
+
+	if _, err := diff.ForgetPrefix([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	expect(1)
+
+	if err := diff.Reset(true); err != nil {
+		t.Fatal(err)
+	}
+	expect(0)
+}
+
+func TestDifferential_Remove_MapCommitted(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_remove_map_committed", WithRetainCommitted(), WithSequenceNumbers())
+	defer done()
+
+	for _, id := range []string{"a", "b"} {
+		if _, err := diff.Add(NewIDObject([]byte(id), id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(NewIDObject([]byte("c"), "c")); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "c"} {
+		if err := diff.Remove([]byte(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mapped []string
+	err := diff.MapCommitted(context.Background(), func(id []byte, old Decoder) (interface{}, error) {
+		mapped = append(mapped, string(id))
+		return NewIDObject(id, "migrated"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mapped) != 1 || mapped[0] != "b" {
+		t.Fatalf("Expected only b to be migrated; got %q", mapped)
+	}
+	if deleted, err := diff.IsDeleted([]byte("a")); err != nil || !deleted {
+		t.Fatalf("Expected a to remain deleted; got %v %v", deleted, err)
+	}
+
+	err = diff.ViewUserDataTx(func(tx *bolt.Tx, _ *bolt.Bucket) error {
+		b := tx.Bucket(diff.q)
+		if b.Bucket(bucketCommittedData).Get([]byte("a")) != nil {
+			t.Error("Expected the committed payload of a to be removed")
+		}
+		if n := b.Bucket(bucketSequence).Stats().KeyN; n != 0 {
+			t.Errorf("Expected the sequence number of c to be released; got %d sequence numbers", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
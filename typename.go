@@ -0,0 +1,62 @@
+package diffdb
+
+import (
+	"bytes"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"reflect"
+)
+
+// ErrTypeMismatch indicates that MustMatchType() was enabled and an object of a different type
+// to the one recorded for the differential was added.
+var ErrTypeMismatch = errors.New("diffdb: object type does not match the type recorded for the differential")
+
+var keyTypeName = []byte("type")
+
+// typeNameOf returns the fully qualified name of the type of x.
+func typeNameOf(x interface{}) string {
+	t := reflect.TypeOf(x)
+	if t == nil {
+		return ""
+	}
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}
+
+// checkType records the type name of x if no type has been recorded yet.
+// If the type name is already recorded and type matching is enabled then ErrTypeMismatch is returned
+// if the type of x differs from it.
+func (diff *Differential) checkType(b *bolt.Bucket, x interface{}) error {
+	var (
+		bm       = b.Bucket(bucketDiffMeta)
+		name     = []byte(typeNameOf(x))
+		existing = bm.Get(keyTypeName)
+	)
+
+	if existing == nil {
+		return bm.Put(keyTypeName, name)
+	}
+	if diff.matchType && bytes.Compare(existing, name) != 0 {
+		return errors.Wrapf(ErrTypeMismatch, "diffdb: got %s, expected %s", name, existing)
+	}
+	return nil
+}
+
+// TypeName returns the fully qualified Go type name of the first object added to the differential.
+// An empty string is returned if no object has been added yet.
+func (diff *Differential) TypeName() (name string, err error) {
+	err = diff.db.View(func(tx *bolt.Tx) error {
+		name = string(tx.Bucket(diff.q).Bucket(bucketDiffMeta).Get(keyTypeName))
+		return nil
+	})
+	return
+}
+
+// MustMatchType sets a flag to validate that subsequent calls to Add are given objects of the same type
+// as the type recorded by TypeName, returning ErrTypeMismatch otherwise.
+// This guards against accidentally mixing object types in the same differential.
+func (diff *Differential) MustMatchType() {
+	diff.matchType = true
+}
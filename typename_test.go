@@ -0,0 +1,37 @@
+package diffdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDifferential_TypeName(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_type_name")
+	defer done()
+
+	name, err := diff.TypeName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "" {
+		t.Fatalf("Expected no type name; got %q", name)
+	}
+
+	diff.MustMatchType()
+	if _, err := diff.Add(IDMapper{id: []byte("1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err = diff.TypeName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "github.com/relvacode/diffdb.IDMapper" {
+		t.Fatalf("Unexpected type name %q", name)
+	}
+
+	_, err = diff.Add(NewIDObject([]byte("2"), 2))
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("Expected %q; got %v", ErrTypeMismatch, err)
+	}
+}
@@ -0,0 +1,179 @@
+package diffdb
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+)
+
+// SkipUnhashableHash is the name of a hash algorithm that behaves like DefaultHash
+// but skips fields and values that cannot be hashed, such as functions and channels, instead of returning an error.
+// Select it for a differential with Differential.UseHash.
+// Changes to skipped fields are not detected, and it produces different hashes to DefaultHash.
+const SkipUnhashableHash = "hashstructure64-skip"
+
+// ErrUnhashable indicates that an object contains a value that cannot be hashed by DefaultHash.
+// The returned error wraps ErrUnhashable with the path of the offending field.
+var ErrUnhashable = errors.New("diffdb: object cannot be hashed")
+
+func init() {
+	RegisterHash(SkipUnhashableHash, func(x interface{}) ([]byte, error) {
+		return hashStructure64(skipUnhashable(reflect.ValueOf(x)))
+	})
+}
+
+// unhashable returns true if values of kind k cannot be hashed.
+func unhashable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// hashedFields returns the indexes of the fields of struct type t that are hashed:
+// exported fields that are not ignored with a `hash:"ignore"` or `hash:"-"` tag.
+func hashedFields(t reflect.Type) []int {
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if tag := f.Tag.Get(hashTagName); tag == "ignore" || tag == "-" {
+			continue
+		}
+		fields = append(fields, i)
+	}
+	return fields
+}
+
+// describeUnhashable wraps ErrUnhashable with the path and type of the first value in x that cannot be hashed.
+// If no such value is found then err is returned unchanged.
+func describeUnhashable(x interface{}, err error) error {
+	if path, t, ok := findUnsupported(reflect.ValueOf(x), "object", unhashable, hashedFields); ok {
+		return errors.Wrapf(ErrUnhashable, "diffdb: %s has type %s", path, t)
+	}
+	return err
+}
+
+// findUnsupported searches v for a value whose kind is unsupported, returning its path from the root named path.
+// Only the fields of structs returned by fields are searched.
+func findUnsupported(v reflect.Value, path string, unsupported func(reflect.Kind) bool, fields func(reflect.Type) []int) (string, reflect.Type, bool) {
+	if !v.IsValid() {
+		return "", nil, false
+	}
+	if unsupported(v.Kind()) {
+		return path, v.Type(), true
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return findUnsupported(v.Elem(), path, unsupported, fields)
+	case reflect.Struct:
+		t := v.Type()
+		for _, i := range fields(t) {
+			if p, ft, ok := findUnsupported(v.Field(i), path+"."+t.Field(i).Name, unsupported, fields); ok {
+				return p, ft, true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if p, ft, ok := findUnsupported(v.Index(i), fmt.Sprintf("%s[%d]", path, i), unsupported, fields); ok {
+				return p, ft, true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if p, ft, ok := findUnsupported(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), unsupported, fields); ok {
+				return p, ft, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// skipUnhashable returns a copy of v with every value that cannot be hashed removed.
+// Structs are rebuilt from their hashed fields so that the "set" tag is still honoured,
+// fields tagged with "string" are replaced by their String value,
+// and unhashable elements of slices and maps are replaced by nil.
+func skipUnhashable(v reflect.Value) interface{} {
+	if !v.IsValid() || unhashable(v.Kind()) {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return skipUnhashable(v.Elem())
+
+	case reflect.Struct:
+		t := v.Type()
+		var (
+			fields []reflect.StructField
+			values []interface{}
+		)
+		for _, i := range hashedFields(t) {
+			f := t.Field(i)
+			fv := v.Field(i)
+			if unhashable(fv.Kind()) {
+				continue
+			}
+
+			var x interface{}
+			switch f.Tag.Get(hashTagName) {
+			case "string":
+				if s, ok := fv.Interface().(fmt.Stringer); ok {
+					x = s.String()
+				} else {
+					x = skipUnhashable(fv)
+				}
+			case "set":
+				x = skipUnhashable(fv)
+				fields = append(fields, reflect.StructField{Name: f.Name, Type: interfaceType, Tag: `hash:"set"`})
+				values = append(values, x)
+				continue
+			default:
+				x = skipUnhashable(fv)
+			}
+			fields = append(fields, reflect.StructField{Name: f.Name, Type: interfaceType})
+			values = append(values, x)
+		}
+
+		s := reflect.New(reflect.StructOf(fields)).Elem()
+		for i, x := range values {
+			if x != nil {
+				s.Field(i).Set(reflect.ValueOf(x))
+			}
+		}
+		return s.Interface()
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = skipUnhashable(v.Index(i))
+		}
+		return out
+
+	case reflect.Map:
+		if v.IsNil() || unhashable(v.Type().Key().Kind()) {
+			return nil
+		}
+		out := make(map[interface{}]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[iter.Key().Interface()] = skipUnhashable(iter.Value())
+		}
+		return out
+	}
+
+	return v.Interface()
+}
@@ -0,0 +1,71 @@
+package diffdb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type unhashableObject struct {
+	Name     string
+	Tags     []string `hash:"set"`
+	Callback func()
+	Events   chan int
+}
+
+func TestHashOf_Unhashable(t *testing.T) {
+	_, err := HashOf(unhashableObject{Name: "a"})
+	if !errors.Is(err, ErrUnhashable) {
+		t.Fatalf("Expected %q; got %v", ErrUnhashable, err)
+	}
+	if !strings.Contains(err.Error(), "object.Callback has type func()") {
+		t.Fatalf("Expected error to name the unhashable field; got %q", err)
+	}
+}
+
+func TestSkipUnhashableHash(t *testing.T) {
+	hash := func(x interface{}) string {
+		h, err := HashOfWith(SkipUnhashableHash, x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(h)
+	}
+
+	a := hash(unhashableObject{Name: "a", Tags: []string{"x", "y"}, Callback: func() {}})
+	if b := hash(unhashableObject{Name: "a", Tags: []string{"y", "x"}, Events: make(chan int)}); a != b {
+		t.Fatal("Expected objects differing only by unhashable fields and set order to be equal")
+	}
+	if b := hash(unhashableObject{Name: "b", Tags: []string{"x", "y"}}); a == b {
+		t.Fatal("Expected objects with different names to differ")
+	}
+	if b := hash(&unhashableObject{Name: "a", Tags: []string{"x", "y"}}); a != b {
+		t.Fatal("Expected a pointer to hash the same as its value")
+	}
+}
+
+type unencodableObject struct {
+	Id       string
+	Callback func() `hash:"ignore"`
+	Internal func() `hash:"ignore" msgpack:"-"`
+}
+
+func (o unencodableObject) ID() []byte {
+	return []byte(o.Id)
+}
+
+func TestDifferential_Add_Unencodable(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_add_unencodable")
+	defer done()
+
+	_, err := diff.Add(unencodableObject{Id: "a", Callback: func() {}})
+	if !errors.Is(err, ErrUnencodable) {
+		t.Fatalf("Expected %q; got %v", ErrUnencodable, err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "object.Callback has type func()") || !strings.Contains(msg, "61") {
+		t.Fatalf("Expected error to name the id and unencodable field; got %q", msg)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected nothing to be staged; got %d pending", pending)
+	}
+}
@@ -0,0 +1,71 @@
+package diffdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCounter indicates that the user data value given to IncrUserCounter is not a counter.
+var ErrInvalidCounter = errors.New("diffdb: user data value is not a counter")
+
+// PutUserValue stores v under key in the user data of the differential,
+// encoded with the same codec as payloads, which is msgpack unless WithCodec is used.
+// This is a typed alternative to UpdateUserData for values such as run times and cursors.
+func (diff *Differential) PutUserValue(key string, v interface{}) error {
+	data, err := encodePayload(v, diff.codec)
+	if err != nil {
+		return err
+	}
+	return diff.UpdateUserData(func(b *bolt.Bucket) error {
+		return b.Put([]byte(key), data)
+	})
+}
+
+// GetUserValue decodes the value stored under key by PutUserValue into v.
+// found is false if there is no value stored under key, in which case v is not modified.
+func (diff *Differential) GetUserValue(key string, v interface{}) (found bool, err error) {
+	err = diff.ViewUserData(func(b *bolt.Bucket) error {
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+
+		found = true
+		d := msgpackDecoder{data: data}
+		return d.Decode(v)
+	})
+	return
+}
+
+// counterMagic prefixes the value of each counter stored by IncrUserCounter,
+// so that other user data values are not mistaken for counters.
+var counterMagic = []byte("diffdb.ctr\x00")
+
+// IncrUserCounter atomically adds delta to the counter stored under key in the user data of the differential
+// and returns its new value, such as to number runs. A counter that does not exist starts at 0,
+// so the current value can be read by adding 0.
+// Counters are stored as a fixed prefix followed by an 8 byte big endian integer;
+// a value under key that was not stored by IncrUserCounter returns an error wrapping ErrInvalidCounter.
+func (diff *Differential) IncrUserCounter(key string, delta int64) (n int64, err error) {
+	err = diff.UpdateUserData(func(b *bolt.Bucket) error {
+		n = 0
+		if v := b.Get([]byte(key)); v != nil {
+			if len(v) != len(counterMagic)+8 || !bytes.HasPrefix(v, counterMagic) {
+				return errors.Wrapf(ErrInvalidCounter, "diffdb: IncrUserCounter: key %s", key)
+			}
+			n = int64(binary.BigEndian.Uint64(v[len(counterMagic):]))
+		}
+
+		n += delta
+		v := make([]byte, len(counterMagic)+8)
+		copy(v, counterMagic)
+		binary.BigEndian.PutUint64(v[len(counterMagic):], uint64(n))
+		return b.Put([]byte(key), v)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
@@ -0,0 +1,96 @@
+package diffdb
+
+import (
+	"errors"
+	"github.com/boltdb/bolt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type runInfo struct {
+	Cursor   string
+	Finished time.Time
+}
+
+func TestDifferential_UserValue(t *testing.T) {
+	const codecJSON byte = 100
+	RegisterCodec(codecJSON, jsonCodec{})
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "msgpack"},
+		{name: "codec", opts: []Option{WithCodec(codecJSON)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, done := openTestDifferential(t, "test_user_value", tc.opts...)
+			defer done()
+
+			var got runInfo
+			found, err := diff.GetUserValue("run", &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found {
+				t.Fatal("Expected no value before it is stored")
+			}
+
+			expect := runInfo{Cursor: "42", Finished: time.Unix(1600000000, 0).UTC()}
+			if err := diff.PutUserValue("run", expect); err != nil {
+				t.Fatal(err)
+			}
+			found, err = diff.GetUserValue("run", &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !found || got.Cursor != expect.Cursor || !got.Finished.Equal(expect.Finished) {
+				t.Fatalf("Expected %+v; got %+v (found %v)", expect, got, found)
+			}
+		})
+	}
+}
+
+func TestDifferential_IncrUserCounter(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_user_counter")
+	defer done()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := diff.IncrUserCounter("runs", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := diff.IncrUserCounter("runs", -3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 {
+		t.Fatalf("Expected counter 7; got %d", n)
+	}
+
+	if err := diff.PutUserValue("name", "not a counter"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.IncrUserCounter("name", 1); !errors.Is(err, ErrInvalidCounter) {
+		t.Fatalf("Expected %q; got %v", ErrInvalidCounter, err)
+	}
+
+	// A raw 8 byte value is not a counter
+	err = diff.UpdateUserData(func(b *bolt.Bucket) error {
+		return b.Put([]byte("raw"), []byte("12345678"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.IncrUserCounter("raw", 1); !errors.Is(err, ErrInvalidCounter) {
+		t.Fatalf("Expected %q for a raw 8 byte value; got %v", ErrInvalidCounter, err)
+	}
+}
@@ -0,0 +1,106 @@
+package diffdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"reflect"
+)
+
+var (
+	// ErrStaleVersion indicates that an object given to Add has an older version than the version
+	// already known for its ID when versioning is enabled with WithVersionField.
+	ErrStaleVersion = errors.New("diffdb: object version is older than the committed version")
+
+	// ErrNoVersionField indicates that an object given to Add does not have the integer version field
+	// named by WithVersionField.
+	ErrNoVersionField = errors.New("diffdb: object has no version field")
+)
+
+// WithVersionField enables optimistic versioning using the named integer field of each object given to Add.
+// Adding an object with a lower version than the committed version of its ID, or the version of its pending change,
+// returns an error wrapping ErrStaleVersion and nothing is staged.
+// Objects with an equal or greater version are staged as usual.
+// This protects against out-of-order ingestion when multiple producers add the same IDs.
+// The field may be of any signed or unsigned integer type, but the type must not change between versions of an object.
+// Objects that do not have the field, either directly or through an embedded struct, return an error wrapping ErrNoVersionField.
+func WithVersionField(name string) Option {
+	return func(db *DB) {
+		db.versionField = name
+	}
+}
+
+// versionOf returns the value of the version field of x encoded so that versions sort in numeric order.
+// Unsigned versions are encoded as big endian uint64, signed versions have their sign bit flipped first.
+func versionOf(x interface{}, field string) ([]byte, error) {
+	v := reflect.ValueOf(x)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, errors.Wrapf(ErrNoVersionField, "diffdb: %q of nil %T", field, x)
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errors.Wrapf(ErrNoVersionField, "diffdb: %q of %T", field, x)
+	}
+
+	f := v.FieldByName(field)
+	version := make([]byte, 8)
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		binary.BigEndian.PutUint64(version, uint64(f.Int())^(1<<63))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		binary.BigEndian.PutUint64(version, f.Uint())
+	default:
+		return nil, errors.Wrapf(ErrNoVersionField, "diffdb: %q of %T", field, x)
+	}
+	return version, nil
+}
+
+// checkVersion returns an error wrapping ErrStaleVersion if version is older than the latest known version of id in b.
+// The latest known version is the version of the pending change of id if there is one, otherwise the committed version.
+func checkVersion(b *bolt.Bucket, id, version []byte) error {
+	var latest []byte
+	if bpv := b.Bucket(bucketPendingVersions); bpv != nil && b.Bucket(bucketPendingHashes).Get(id) != nil {
+		latest = bpv.Get(id)
+	}
+	if bcv := b.Bucket(bucketCommittedVersions); latest == nil && bcv != nil {
+		latest = bcv.Get(id)
+	}
+	if latest != nil && bytes.Compare(version, latest) < 0 {
+		return errors.Wrapf(ErrStaleVersion, "diffdb: id %x", id)
+	}
+	return nil
+}
+
+// stageVersion stores version as the version of the pending change of id in b.
+func stageVersion(b *bolt.Bucket, id, version []byte) error {
+	bpv, err := b.CreateBucketIfNotExists(bucketPendingVersions)
+	if err != nil {
+		return err
+	}
+	return bpv.Put(id, version)
+}
+
+// commitVersion moves the version of the pending change of id in b to its committed version.
+// Changes that were staged without a version leave the committed version unchanged.
+func commitVersion(b *bolt.Bucket, id []byte) error {
+	bpv := b.Bucket(bucketPendingVersions)
+	if bpv == nil {
+		return nil
+	}
+	version := bpv.Get(id)
+	if version == nil {
+		return nil
+	}
+
+	bcv, err := b.CreateBucketIfNotExists(bucketCommittedVersions)
+	if err != nil {
+		return err
+	}
+	if err := bcv.Put(id, append([]byte(nil), version...)); err != nil {
+		return err
+	}
+	return bpv.Delete(id)
+}
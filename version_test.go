@@ -0,0 +1,60 @@
+package diffdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type versionedObject struct {
+	Key     string
+	Version int
+	Value   string
+}
+
+func (o versionedObject) ID() []byte {
+	return []byte(o.Key)
+}
+
+func TestDifferential_WithVersionField(t *testing.T) {
+	diff, done := openTestDifferential(t, "test_version", WithVersionField("Version"))
+	defer done()
+
+	apply := func() {
+		if err := diff.Each(context.Background(), func(id []byte, data Decoder) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := diff.Add(versionedObject{Key: "a", Version: 2, Value: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	apply()
+
+	if _, err := diff.Add(versionedObject{Key: "a", Version: 1, Value: "v1"}); !errors.Is(err, ErrStaleVersion) {
+		t.Fatalf("Expected %q; got %v", ErrStaleVersion, err)
+	}
+	if pending := diff.CountChanges(); pending != 0 {
+		t.Fatalf("Expected no pending changes; got %d", pending)
+	}
+
+	// A pending change must not be replaced by an older version either
+	if _, err := diff.Add(versionedObject{Key: "a", Version: 4, Value: "v4"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := diff.Add(versionedObject{Key: "a", Version: 3, Value: "v3"}); !errors.Is(err, ErrStaleVersion) {
+		t.Fatalf("Expected %q; got %v", ErrStaleVersion, err)
+	}
+	if _, err := diff.Add(versionedObject{Key: "a", Version: 4, Value: "v4 again"}); err != nil {
+		t.Fatalf("Expected an equal version to be accepted; got %v", err)
+	}
+	apply()
+
+	if _, err := diff.Add(versionedObject{Key: "a", Version: 3, Value: "v3"}); !errors.Is(err, ErrStaleVersion) {
+		t.Fatalf("Expected %q; got %v", ErrStaleVersion, err)
+	}
+
+	if _, err := diff.Add(NewIDObject([]byte("b"), "no version")); !errors.Is(err, ErrNoVersionField) {
+		t.Fatalf("Expected %q; got %v", ErrNoVersionField, err)
+	}
+}